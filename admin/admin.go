@@ -0,0 +1,340 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/metrics"
+	"github.com/cantara/vili/quarantine"
+	"github.com/cantara/vili/server"
+	"github.com/cantara/vili/zip"
+)
+
+type Controller interface {
+	Status() server.Status
+	Scores() []server.ScorePoint
+	Mismatches() []server.Mismatch
+	Deploy(wait bool) (queued bool, err error)
+	ResetTest() error
+	RestartRunning() error
+	RestartTesting() error
+	AbandonTesting(reason string) error
+	PausePromotion() error
+	ResumePromotion() error
+	Freeze() error
+	Unfreeze() error
+	Approve() error
+	Reject(reason string) error
+	Events(eventlog.Filter) ([]eventlog.Event, error)
+	Archives() ([]zip.Archive, error)
+	RollbackTo(version string, force bool) error
+	QuarantineList() []quarantine.Entry
+	Unquarantine(version string) error
+}
+
+type Response struct {
+	Message string      `json:"message,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// SocketFromEnv is the absolute path of admin_socket, or vili.sock, where a relative path is in the base folder.
+func SocketFromEnv(base string) string {
+	path := os.Getenv("admin_socket")
+	if path == "" {
+		path = "vili.sock"
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// Serve listens on a unix socket only the user running vili can use, and on addr when it is set.
+// Requests on addr need token as bearer token when it is set. The returned function stops both.
+func Serve(c Controller, socket, addr, token string) (stop func(), err error) {
+	handler := newMux(c)
+	err = os.Remove(socket) //A socket left behind by a crash blocks listening
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return
+	}
+	err = os.Chmod(socket, 0600)
+	if err != nil {
+		listener.Close()
+		return
+	}
+	servers := []*http.Server{serve(listener, handler)}
+	if addr != "" {
+		var tcp net.Listener
+		tcp, err = net.Listen("tcp", addr)
+		if err != nil {
+			servers[0].Close()
+			os.Remove(socket)
+			return
+		}
+		if token == "" {
+			log.Warning("Admin api on ", addr, " has no admin_token, anyone who can reach it can control vili")
+		}
+		servers = append(servers, serve(tcp, authenticate(token, handler)))
+	}
+	return func() {
+		for _, s := range servers {
+			s.Shutdown(context.Background())
+		}
+		os.Remove(socket)
+	}, nil
+}
+
+func serve(listener net.Listener, handler http.Handler) *http.Server {
+	s := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := s.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.AddError(err).Error("Admin api stopped")
+		}
+	}()
+	return s
+}
+
+func authenticate(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && (r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/dashboard/")) { //The dashboard is static, its api calls carry the token
+			next.ServeHTTP(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(Response{Error: "Unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newMux(c Controller) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServer(http.FS(dashboardFiles()))))
+	mux.Handle("GET /{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		respondData(w, c.Status(), nil)
+	})
+	mux.HandleFunc("GET /scores", func(w http.ResponseWriter, r *http.Request) {
+		respondData(w, c.Scores(), nil)
+	})
+	mux.HandleFunc("GET /mismatches", func(w http.ResponseWriter, r *http.Request) {
+		respondData(w, c.Mismatches(), nil)
+	})
+	mux.HandleFunc("POST /deploy", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			NoWait bool `json:"no_wait"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+		queued, err := c.Deploy(!body.NoWait)
+		if err == nil && queued {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(Response{Message: "Testing version is queued for the next deploy window"})
+			return
+		}
+		respond(w, "Testing version deployed", err)
+	})
+	mux.HandleFunc("POST /reset", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, "Test restarted", c.ResetTest())
+	})
+	mux.HandleFunc("POST /restart/{type}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("type") {
+		case "running":
+			respond(w, "Running restarted", c.RestartRunning())
+		case "testing", "test":
+			respond(w, "Testing restarted", c.RestartTesting())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{Error: "Only running and testing can be restarted"})
+		}
+	})
+	mux.HandleFunc("POST /abandon", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+		if body.Reason == "" {
+			body.Reason = "abandoned by hand"
+		}
+		respond(w, "Testing version abandoned", c.AbandonTesting(body.Reason))
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, "Automatic promotion paused", c.PausePromotion())
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, "Automatic promotion resumed", c.ResumePromotion())
+	})
+	mux.HandleFunc("POST /freeze", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, "Vili is frozen", c.Freeze())
+	})
+	mux.HandleFunc("POST /unfreeze", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, "Vili is unfrozen", c.Unfreeze())
+	})
+	mux.HandleFunc("POST /approve", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, "Testing version approved", c.Approve())
+	})
+	mux.HandleFunc("POST /reject", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+		if body.Reason == "" {
+			body.Reason = "rejected by hand"
+		}
+		respond(w, "Testing version rejected and quarantined", c.Reject(body.Reason))
+	})
+	mux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		events, err := c.Events(eventlog.Filter{Types: eventlog.History})
+		respondData(w, events, err)
+	})
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{Error: err.Error()})
+			return
+		}
+		events, err := c.Events(filter)
+		respondData(w, events, err)
+	})
+	mux.HandleFunc("GET /archives", func(w http.ResponseWriter, r *http.Request) {
+		archives, err := c.Archives()
+		respondData(w, archives, err)
+	})
+	mux.HandleFunc("POST /rollback", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Version string `json:"version"`
+			Force   bool   `json:"force"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+		if body.Version == "" {
+			respond(w, "", fmt.Errorf("No version given"))
+			return
+		}
+		message := fmt.Sprintf("Version %s is started as testing", body.Version)
+		if body.Force {
+			message = fmt.Sprintf("Version %s replaced running", body.Version)
+		}
+		respond(w, message, c.RollbackTo(body.Version, body.Force))
+	})
+	mux.HandleFunc("GET /quarantine", func(w http.ResponseWriter, r *http.Request) {
+		respondData(w, c.QuarantineList(), nil)
+	})
+	mux.HandleFunc("DELETE /quarantine/{version}", func(w http.ResponseWriter, r *http.Request) {
+		version := r.PathValue("version")
+		respond(w, fmt.Sprintf("Version %s is no longer quarantined", version), c.Unquarantine(version))
+	})
+	return mux
+}
+
+const defaultEventLimit = 500
+
+// parseFilter reads version, type (comma separated), since, until and limit. Times are RFC 3339 or a duration ago like 2h.
+func parseFilter(q url.Values) (f eventlog.Filter, err error) {
+	f.Version = q.Get("version")
+	for _, t := range strings.Split(q.Get("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			f.Types = append(f.Types, eventlog.Type(t))
+		}
+	}
+	f.Since, err = parseTime(q.Get("since"))
+	if err != nil {
+		return
+	}
+	f.Until, err = parseTime(q.Get("until"))
+	if err != nil {
+		return
+	}
+	f.Limit = defaultEventLimit
+	if limit := q.Get("limit"); limit != "" {
+		f.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			err = fmt.Errorf("Invalid limit %q", limit)
+		}
+	}
+	return
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("Invalid time %q, use RFC 3339 or a duration like 2h", s)
+	}
+	return t, nil
+}
+
+// decode reads an optional json body, on failure the error is allready responded.
+func decode(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Error: fmt.Sprintf("Invalid body: %v", err)})
+		return false
+	}
+	return true
+}
+
+func respond(w http.ResponseWriter, message string, err error) {
+	write(w, Response{Message: message}, err)
+}
+
+func respondData(w http.ResponseWriter, data interface{}, err error) {
+	write(w, Response{Data: data}, err)
+}
+
+func write(w http.ResponseWriter, r Response, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(r)
+}
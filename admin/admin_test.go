@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/quarantine"
+	"github.com/cantara/vili/server"
+	"github.com/cantara/vili/zip"
+)
+
+type controller struct {
+	approved bool
+	rejected string
+	restored string
+	forced   bool
+
+	quarantined []quarantine.Entry
+	paused      bool
+	frozen      bool
+	filter      eventlog.Filter
+
+	outsideWindow bool
+}
+
+func (c *controller) Status() server.Status {
+	return server.Status{Hostname: "host", Paused: c.paused}
+}
+
+func (c *controller) Scores() []server.ScorePoint {
+	return []server.ScorePoint{{Version: "app-1.0.1", Score: 0.5}}
+}
+
+func (c *controller) Mismatches() []server.Mismatch {
+	return []server.Mismatch{{Route: "GET /health", Expected: 200, Got: 404}}
+}
+
+func (c *controller) ResetTest() error            { return nil }
+func (c *controller) RestartRunning() error       { return nil }
+func (c *controller) RestartTesting() error       { return fmt.Errorf("No testing version to restart") }
+func (c *controller) AbandonTesting(string) error { return nil }
+func (c *controller) PausePromotion() error       { c.paused = true; return nil }
+func (c *controller) ResumePromotion() error      { c.paused = false; return nil }
+func (c *controller) Freeze() error               { c.frozen = true; return nil }
+func (c *controller) Unfreeze() error             { c.frozen = false; return nil }
+
+func (c *controller) Deploy(wait bool) (bool, error) {
+	if !c.outsideWindow {
+		return false, nil
+	}
+	if !wait {
+		return false, server.ErrOutsideDeployWindow
+	}
+	return true, nil
+}
+
+func (c *controller) Approve() error {
+	if c.approved {
+		return fmt.Errorf("Allready approved")
+	}
+	c.approved = true
+	return nil
+}
+
+func (c *controller) Reject(reason string) error {
+	c.rejected = reason
+	return nil
+}
+
+func (c *controller) Events(f eventlog.Filter) ([]eventlog.Event, error) {
+	c.filter = f
+	return []eventlog.Event{{Type: eventlog.PROMOTED, Version: "app-1.0.0"}}, nil
+}
+
+func (c *controller) Archives() ([]zip.Archive, error) {
+	return []zip.Archive{{Version: "app-1.0.0", Size: 42}}, nil
+}
+
+func (c *controller) RollbackTo(version string, force bool) error {
+	if version != "app-1.0.0" {
+		return fmt.Errorf("No archive of %s", version)
+	}
+	c.restored, c.forced = version, force
+	return nil
+}
+
+func (c *controller) QuarantineList() []quarantine.Entry {
+	return c.quarantined
+}
+
+func (c *controller) Unquarantine(version string) error {
+	for i, e := range c.quarantined {
+		if e.Version == version {
+			c.quarantined = append(c.quarantined[:i], c.quarantined[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("Version %s is not quarantined", version)
+}
+
+func TestApi(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "vili.sock")
+	c := &controller{quarantined: []quarantine.Entry{{Version: "app-1.0.1", Reason: "rejected"}}}
+	stop, err := Serve(c, socket, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	client := NewClient(socket)
+
+	if _, err = client.Do("POST", "/approve", nil, nil); err != nil || !c.approved {
+		t.Errorf("Approve failed, %v", err)
+	}
+	if _, err = client.Do("POST", "/approve", nil, nil); err == nil {
+		t.Error("Error from controller was not returned")
+	}
+	if message, err := client.Do("POST", "/deploy", nil, nil); err != nil || message != "Testing version deployed" {
+		t.Errorf("Deploy = %q, %v", message, err)
+	}
+	c.outsideWindow = true
+	resp, err := client.http.Post("http://vili/deploy", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Deploy outside of the deploy window answered %d, expected 202", resp.StatusCode)
+	}
+	if message, err := client.Do("POST", "/deploy", map[string]bool{"no_wait": true}, nil); err == nil {
+		t.Errorf("Deploy outside of the deploy window without waiting = %q", message)
+	}
+	if _, err = client.Do("POST", "/reject", map[string]string{"reason": "slow"}, nil); err != nil || c.rejected != "slow" {
+		t.Errorf("Reject failed, got reason %q, %v", c.rejected, err)
+	}
+	if _, err = client.Do("POST", "/reject", nil, nil); err != nil || c.rejected != "rejected by hand" {
+		t.Errorf("Reject without reason failed, got reason %q, %v", c.rejected, err)
+	}
+
+	var events []eventlog.Event
+	if _, err = client.Do("GET", "/history", nil, &events); err != nil || len(events) != 1 || events[0].Type != eventlog.PROMOTED || len(c.filter.Types) != len(eventlog.History) {
+		t.Errorf("History = %v with filter %+v, %v", events, c.filter, err)
+	}
+	var logged []eventlog.Event
+	if _, err = client.Do("GET", "/events?version=app-1.0.0&type=promoted,rolled_back&since=1h&limit=10", nil, &logged); err != nil || len(logged) != 1 {
+		t.Errorf("Events = %v, %v", logged, err)
+	}
+	if f := c.filter; f.Version != "app-1.0.0" || len(f.Types) != 2 || f.Types[1] != eventlog.ROLLEDBACK || f.Limit != 10 || time.Since(f.Since) < 59*time.Minute {
+		t.Errorf("Events filter = %+v", f)
+	}
+	if _, err = client.Do("GET", "/events?until=yesterday", nil, nil); err == nil {
+		t.Error("Invalid time should fail")
+	}
+	var archives []zip.Archive
+	if _, err = client.Do("GET", "/archives", nil, &archives); err != nil || len(archives) != 1 || archives[0].Size != 42 {
+		t.Errorf("Archives = %v, %v", archives, err)
+	}
+	if _, err = client.Do("POST", "/rollback", map[string]interface{}{"version": "app-1.0.0", "force": true}, nil); err != nil || c.restored != "app-1.0.0" || !c.forced {
+		t.Errorf("Rollback failed, got %q %v, %v", c.restored, c.forced, err)
+	}
+	if _, err = client.Do("POST", "/rollback", map[string]interface{}{"version": "app-0.0.1"}, nil); err == nil {
+		t.Error("Rollback to missing archive should fail")
+	}
+
+	var quarantined []quarantine.Entry
+	if _, err = client.Do("GET", "/quarantine", nil, &quarantined); err != nil || len(quarantined) != 1 {
+		t.Errorf("Quarantine = %v, %v", quarantined, err)
+	}
+	if _, err = client.Do("DELETE", "/quarantine/app-1.0.1", nil, nil); err != nil || len(c.quarantined) != 0 {
+		t.Errorf("Unquarantine failed, %v", err)
+	}
+	if _, err = client.Do("DELETE", "/quarantine/app-1.0.1", nil, nil); err == nil {
+		t.Error("Unquarantining twice should fail")
+	}
+
+	if _, err = client.Do("POST", "/pause", nil, nil); err != nil || !c.paused {
+		t.Errorf("Pause failed, %v", err)
+	}
+	if _, err = client.Do("POST", "/freeze", nil, nil); err != nil || !c.frozen {
+		t.Errorf("Freeze failed, %v", err)
+	}
+	if _, err = client.Do("POST", "/unfreeze", nil, nil); err != nil || c.frozen {
+		t.Errorf("Unfreeze failed, %v", err)
+	}
+	var scores []server.ScorePoint
+	if _, err = client.Do("GET", "/scores", nil, &scores); err != nil || len(scores) != 1 || scores[0].Score != 0.5 {
+		t.Errorf("Scores = %v, %v", scores, err)
+	}
+	var mismatches []server.Mismatch
+	if _, err = client.Do("GET", "/mismatches", nil, &mismatches); err != nil || len(mismatches) != 1 || mismatches[0].Got != 404 {
+		t.Errorf("Mismatches = %v, %v", mismatches, err)
+	}
+	var status server.Status
+	if _, err = client.Do("GET", "/status", nil, &status); err != nil || !status.Paused || status.Hostname != "host" {
+		t.Errorf("Status = %+v, %v", status, err)
+	}
+	if _, err = client.Do("POST", "/restart/testing", nil, nil); err == nil {
+		t.Error("Error from restart was not returned")
+	}
+	if _, err = client.Do("POST", "/restart/previous", nil, nil); err == nil {
+		t.Error("Only running and testing should be restartable")
+	}
+}
+
+func TestToken(t *testing.T) {
+	c := &controller{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("Can't listen on tcp: ", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	stop, err := Serve(c, filepath.Join(t.TempDir(), "vili.sock"), addr, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	for token, expected := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "secret": http.StatusOK} {
+		req, _ := http.NewRequest("POST", "http://"+addr+"/pause", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("Token %q got status %d, expected %d", token, resp.StatusCode, expected)
+		}
+	}
+	if !c.paused {
+		t.Error("Authorized request was not handled")
+	}
+
+	for _, path := range []string{"/dashboard/", "/dashboard/dashboard.js"} { //The dashboard asks for the token itself
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s got status %d without token", path, resp.StatusCode)
+		}
+	}
+	resp, err := http.Get("http://" + addr + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Status without token got status %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", "http://"+addr+"/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Metrics got status %d and content type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
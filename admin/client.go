@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+type Client struct {
+	http http.Client
+}
+
+func NewClient(socket string) *Client {
+	return &Client{
+		http: http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Do sends body as json to the admin api and returns the message, data is decoded into out when given.
+// A failed action is returned as an error.
+func (c *Client) Do(method, path string, body, out interface{}) (message string, err error) {
+	var buf bytes.Buffer
+	if body != nil {
+		err = json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			return
+		}
+	}
+	req, err := http.NewRequest(method, "http://vili"+path, &buf)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var r struct {
+		Message string          `json:"message"`
+		Error   string          `json:"error"`
+		Data    json.RawMessage `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return
+	}
+	if r.Error != "" {
+		return "", fmt.Errorf("%s", r.Error)
+	}
+	if out != nil && len(r.Data) > 0 {
+		err = json.Unmarshal(r.Data, out)
+	}
+	return r.Message, err
+}
@@ -0,0 +1,17 @@
+package admin
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed dashboard
+var dashboard embed.FS
+
+func dashboardFiles() fs.FS {
+	files, err := fs.Sub(dashboard, "dashboard")
+	if err != nil {
+		panic(err) //The directory is embedded at build time
+	}
+	return files
+}
@@ -0,0 +1,265 @@
+"use strict";
+
+const tokenKey = "vili-admin-token";
+const statusInterval = 5000;
+const listInterval = 30000;
+
+async function api(method, path, body) {
+  const headers = { "Content-Type": "application/json" };
+  const token = localStorage.getItem(tokenKey);
+  if (token) {
+    headers.Authorization = "Bearer " + token;
+  }
+  const resp = await fetch(path, { method, headers, body: body ? JSON.stringify(body) : undefined });
+  const r = await resp.json();
+  if (r.error) {
+    throw new Error(r.error);
+  }
+  return r;
+}
+
+function showError(err) {
+  const el = document.getElementById("error");
+  el.textContent = err ? err.message : "";
+  el.hidden = !err;
+}
+
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined && text !== null) {
+    e.textContent = text;
+  }
+  if (className) {
+    e.className = className;
+  }
+  return e;
+}
+
+function table(id, headers, rows) {
+  const t = document.getElementById(id);
+  t.replaceChildren();
+  const head = el("tr");
+  headers.forEach(h => head.appendChild(el("th", h)));
+  t.appendChild(head);
+  if (rows.length === 0) {
+    const tr = el("tr");
+    const td = el("td", "none");
+    td.colSpan = headers.length;
+    tr.appendChild(td);
+    t.appendChild(tr);
+    return;
+  }
+  rows.forEach(cells => {
+    const tr = el("tr");
+    cells.forEach(c => {
+      const td = el("td");
+      if (c instanceof Node) {
+        td.appendChild(c);
+      } else {
+        td.textContent = c;
+      }
+      tr.appendChild(td);
+    });
+    t.appendChild(tr);
+  });
+}
+
+function duration(ns) {
+  let s = Math.round(ns / 1e9);
+  const parts = [];
+  for (const [unit, size] of [["d", 86400], ["h", 3600], ["m", 60]]) {
+    if (s >= size) {
+      parts.push(Math.floor(s / size) + unit);
+      s %= size;
+    }
+  }
+  parts.push(s + "s");
+  return parts.slice(0, 2).join(" ");
+}
+
+function time(t) {
+  return new Date(t).toLocaleString();
+}
+
+function verdictClass(verdict) {
+  return { promote: "promote", reject: "reject" }[verdict] || "";
+}
+
+function renderStatus(status) {
+  document.getElementById("host").textContent = status.hostname + ", up " + duration(status.uptime);
+  const state = document.getElementById("state");
+  state.replaceChildren();
+  const badges = [];
+  if (status.frozen) badges.push(["frozen", "frozen"]);
+  if (status.held_version) badges.push(["holding " + status.held_version, "frozen"]);
+  if (status.paused) badges.push(["promotion paused"]);
+  if (status.awaiting_approval) badges.push(["awaiting approval"]);
+  if (status.waiting_for_window) badges.push(["waiting for deploy window"]);
+  badges.forEach(([text, c]) => state.appendChild(el("span", text, "badge " + (c || ""))));
+
+  const versions = document.getElementById("versions");
+  versions.replaceChildren();
+  for (const [name, vs] of [["Running", status.running], ["Testing", status.testing], ["Previous", status.previous]]) {
+    let title = name + ": " + (vs ? vs.version : "none");
+    if (vs && name === "Testing") {
+      title += ", tested for " + duration(status.testing_duration) + " in " + (status.test_windows || []).length + " earlier windows";
+    }
+    versions.appendChild(el("h2", title));
+    if (!vs) {
+      continue;
+    }
+    const c = vs.counters;
+    versions.appendChild(el("p", `${c.requests} requests, ${c.errors} errors, ${c.warnings} warnings, ${c.breaking} breaking, weight ${c.weight} since ${time(vs.mesure_from)}`));
+    const id = "replicas-" + name;
+    versions.appendChild(Object.assign(el("table"), { id }));
+    table(id, ["Port", "Pid", "Ready", "Healthy", "Active", "Uptime", "Startup", "Requests", "Errors", "Warnings", "Breaking"],
+      (vs.replicas || []).map(r => [r.port, r.pid, r.ready ? "yes" : "no", r.healthy ? "yes" : "no", r.active, duration(r.uptime),
+        r.startup_time ? duration(r.startup_time) : "", r.counters.requests, r.counters.errors, r.counters.warnings, r.counters.breaking]));
+  }
+
+  const score = document.getElementById("score");
+  score.replaceChildren();
+  if (status.score) {
+    score.appendChild(el("strong", status.score.verdict, verdictClass(status.score.verdict)));
+    score.appendChild(document.createTextNode(` with score ${status.score.score.toFixed(4)}, ${status.score.summary}`));
+    (status.score.reasons || []).forEach(r => score.appendChild(el("div", r)));
+  } else {
+    score.textContent = status.score_error || "No testing version";
+  }
+}
+
+function renderChart(points, testing) {
+  const svg = document.getElementById("chart");
+  svg.replaceChildren();
+  if (testing) {
+    points = points.filter(p => p.version === testing);
+  }
+  if (points.length === 0) {
+    return;
+  }
+  const ns = "http://www.w3.org/2000/svg";
+  const width = 600, height = 160, pad = 8;
+  const scores = points.map(p => p.score);
+  const min = Math.min(0, ...scores), max = Math.max(0, ...scores);
+  const span = max - min || 1;
+  const x = i => points.length === 1 ? width / 2 : pad + i * (width - 2 * pad) / (points.length - 1);
+  const y = v => height - pad - (v - min) * (height - 2 * pad) / span;
+
+  const zero = document.createElementNS(ns, "line");
+  Object.entries({ x1: 0, x2: width, y1: y(0), y2: y(0), stroke: "#bbb", "stroke-dasharray": "4" }).forEach(([k, v]) => zero.setAttribute(k, v));
+  svg.appendChild(zero);
+  const line = document.createElementNS(ns, "polyline");
+  line.setAttribute("points", points.map((p, i) => `${x(i)},${y(p.score)}`).join(" "));
+  line.setAttribute("fill", "none");
+  line.setAttribute("stroke", "#3367d6");
+  line.setAttribute("stroke-width", "2");
+  line.setAttribute("vector-effect", "non-scaling-stroke");
+  svg.appendChild(line);
+  points.forEach((p, i) => {
+    const dot = document.createElementNS(ns, "circle");
+    dot.setAttribute("cx", x(i));
+    dot.setAttribute("cy", y(p.score));
+    dot.setAttribute("r", 3);
+    dot.setAttribute("fill", { promote: "#1e7b34", reject: "#b52a2a" }[p.verdict] || "#3367d6");
+    const title = document.createElementNS(ns, "title");
+    title.textContent = `${time(p.time)} ${p.version}: ${p.verdict} ${p.score.toFixed(4)}`;
+    dot.appendChild(title);
+    svg.appendChild(dot);
+  });
+}
+
+function actionButton(text, action, body, question) {
+  const b = el("button", text);
+  b.addEventListener("click", () => act(action, body, question));
+  return b;
+}
+
+async function act(action, body, question) {
+  if (question && !confirm(question)) {
+    return;
+  }
+  try {
+    const r = await api("POST", action, body);
+    showError(null);
+    if (r.message) {
+      alert(r.message);
+    }
+  } catch (err) {
+    showError(err);
+  }
+  refresh();
+  refreshLists();
+}
+
+async function refresh() {
+  try {
+    const [status, scores, mismatches] = await Promise.all([api("GET", "/status"), api("GET", "/scores"), api("GET", "/mismatches")]);
+    renderStatus(status.data);
+    renderChart(scores.data || [], status.data.testing && status.data.testing.version);
+    table("mismatches", ["Time", "Role", "Version", "Request", "Route", "Expected", "Got", "Trace"],
+      (mismatches.data || []).map(m => [time(m.time), m.role, m.version, m.method + " " + m.path, m.route, m.expected, m.got, m.trace_id || ""]));
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function refreshLists() {
+  try {
+    const [history, archives, quarantine] = await Promise.all([api("GET", "/history"), api("GET", "/archives"), api("GET", "/quarantine")]);
+    table("history", ["Time", "Action", "Version", "From", "Reason"],
+      (history.data || []).slice(-50).reverse().map(e => [time(e.time), e.type, e.version, e.from || "", e.message || ""]));
+    table("archives", ["Version", "Archived", "Size", ""],
+      (archives.data || []).map(a => {
+        const buttons = el("span");
+        buttons.appendChild(actionButton("Test", "/rollback", { version: a.version }, `Start ${a.version} as testing?`));
+        buttons.appendChild(actionButton("Replace running", "/rollback", { version: a.version, force: true }, `Replace running with ${a.version} without testing?`));
+        return [a.version, time(a.archived), (a.size / 1048576).toFixed(1) + "MB", buttons];
+      }));
+    table("quarantine", ["Version", "Quarantined", "Reason", ""],
+      (quarantine.data || []).map(e => {
+        const b = el("button", "Unquarantine");
+        b.addEventListener("click", async () => {
+          if (!confirm(`Let ${e.version} be tested again?`)) {
+            return;
+          }
+          try {
+            await api("DELETE", "/quarantine/" + encodeURIComponent(e.version));
+          } catch (err) {
+            showError(err);
+          }
+          refreshLists();
+        });
+        return [e.version, time(e.time), e.reason, b];
+      }));
+  } catch (err) {
+    showError(err);
+  }
+}
+
+document.querySelectorAll("[data-action]").forEach(b => {
+  b.addEventListener("click", () => {
+    let body;
+    if (b.dataset.reason) {
+      const reason = prompt(b.dataset.reason);
+      if (reason === null) {
+        return;
+      }
+      body = { reason };
+    }
+    act(b.dataset.action, body, b.dataset.confirm);
+  });
+});
+
+document.getElementById("token").value = localStorage.getItem(tokenKey) || "";
+document.getElementById("token-form").addEventListener("submit", e => {
+  e.preventDefault();
+  localStorage.setItem(tokenKey, document.getElementById("token").value);
+  refresh();
+  refreshLists();
+});
+
+refresh();
+refreshLists();
+setInterval(refresh, statusInterval);
+setInterval(refreshLists, listInterval);
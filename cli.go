@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cantara/vili/admin"
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/quarantine"
+	"github.com/cantara/vili/server"
+	"github.com/cantara/vili/zip"
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: vili [--json] [--base dir] [command]
+Without a command vili starts and manages the service in the current directory.
+Commands talk to the vili running in the base folder, which is --base, vili_base or the current directory.
+--json prints the raw response:
+  status                       show running, testing and previous versions with replicas and score
+  deploy [--no-wait]           promote the testing version now, or at the next deploy window unless --no-wait
+  abandon [reason]             abandon and quarantine the testing version
+  restart running|testing      restart the replicas of a version
+  reset                        restart the test of the testing version
+  pause                        stop automatic promotion, testing and scoring continues
+  resume                       allow automatic promotion again
+  freeze                       stop vili from starting, promoting or rolling back versions
+  unfreeze                     let vili change versions again and start the version held while frozen
+  approve                      promote the testing version awaiting approval
+  reject [reason]              reject and quarantine the testing version
+  history                      list promotions, abandoned versions, rollbacks, restores and restarts
+  events [--version v] [--type t,t] [--since 2h] [--until time] [--limit n]
+                               list servlet, test and deploy events, times are RFC 3339 or a duration ago
+  archives                     list archived versions, newest first
+  rollback <version> [--force] start an archived version as testing, or as running with --force
+  quarantine                   list quarantined versions
+  unquarantine <version>       let a quarantined version be tested again`
+
+func runCommand(args []string) int {
+	asJSON := false
+	base := os.Getenv("vili_base")
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--json":
+			asJSON = true
+		case args[i] == "--base" && i+1 < len(args):
+			i++
+			base = args[i]
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	if len(rest) == 0 {
+		fmt.Fprintf(os.Stderr, "No command given\n%s\n", usage)
+		return 2
+	}
+	args = rest
+	if base == "" {
+		base = "."
+	}
+	base, err := filepath.Abs(base)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	godotenv.Load(filepath.Join(base, ".env")) //Only needed when the admin socket is configured
+	socket := admin.SocketFromEnv(base)
+	client := admin.NewClient(socket)
+	var message string
+	var data interface{} //Set by commands that list something, show prints it for humans
+	var show func()
+	switch args[0] {
+	case "status":
+		var status server.Status
+		_, err = client.Do("GET", "/status", nil, &status)
+		data, show = &status, func() { printStatus(status) }
+	case "deploy":
+		message, err = client.Do("POST", "/deploy", map[string]bool{"no_wait": len(args) > 1 && args[1] == "--no-wait"}, nil)
+	case "abandon":
+		message, err = client.Do("POST", "/abandon", map[string]string{"reason": strings.Join(args[1:], " ")}, nil)
+	case "restart":
+		if len(args) < 2 || (args[1] != "running" && args[1] != "testing") {
+			fmt.Fprintf(os.Stderr, "Restart running or testing\n%s\n", usage)
+			return 2
+		}
+		message, err = client.Do("POST", "/restart/"+args[1], nil, nil)
+	case "reset":
+		message, err = client.Do("POST", "/reset", nil, nil)
+	case "pause":
+		message, err = client.Do("POST", "/pause", nil, nil)
+	case "resume":
+		message, err = client.Do("POST", "/resume", nil, nil)
+	case "freeze":
+		message, err = client.Do("POST", "/freeze", nil, nil)
+	case "unfreeze":
+		message, err = client.Do("POST", "/unfreeze", nil, nil)
+	case "approve":
+		message, err = client.Do("POST", "/approve", nil, nil)
+	case "reject":
+		message, err = client.Do("POST", "/reject", map[string]string{"reason": strings.Join(args[1:], " ")}, nil)
+	case "history":
+		var events []eventlog.Event
+		_, err = client.Do("GET", "/history", nil, &events)
+		data, show = &events, func() { printHistory(events) }
+	case "events":
+		query := url.Values{}
+		for i := 1; i < len(args); i++ {
+			arg := args[i]
+			name, value, found := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			if !found && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			switch name {
+			case "version", "type", "since", "until", "limit":
+				query.Set(name, value)
+			default:
+				fmt.Fprintf(os.Stderr, "Unknown events option %s\n%s\n", arg, usage)
+				return 2
+			}
+		}
+		var events []eventlog.Event
+		_, err = client.Do("GET", "/events?"+query.Encode(), nil, &events)
+		data, show = &events, func() { printEvents(events) }
+	case "archives":
+		var archives []zip.Archive
+		_, err = client.Do("GET", "/archives", nil, &archives)
+		data, show = &archives, func() { printArchives(archives) }
+	case "rollback":
+		body := struct {
+			Version string `json:"version"`
+			Force   bool   `json:"force"`
+		}{}
+		for _, arg := range args[1:] {
+			if arg == "--force" || arg == "-f" {
+				body.Force = true
+				continue
+			}
+			body.Version = arg
+		}
+		if body.Version == "" {
+			fmt.Fprintf(os.Stderr, "No version given\n%s\n", usage)
+			return 2
+		}
+		message, err = client.Do("POST", "/rollback", body, nil)
+	case "quarantine":
+		var entries []quarantine.Entry
+		_, err = client.Do("GET", "/quarantine", nil, &entries)
+		data, show = &entries, func() { printQuarantine(entries) }
+	case "unquarantine":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "No version given\n%s\n", usage)
+			return 2
+		}
+		message, err = client.Do("DELETE", "/quarantine/"+url.PathEscape(args[1]), nil, nil)
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n%s\n", args[0], usage)
+		return 2
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		err = fmt.Errorf("Could not reach vili on %s, is it running in %s? %v", socket, base, err)
+	}
+	if err != nil {
+		if asJSON {
+			printJSON(admin.Response{Error: err.Error()})
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+	switch {
+	case asJSON && data != nil:
+		printJSON(data)
+	case asJSON:
+		printJSON(admin.Response{Message: message})
+	case show != nil:
+		show()
+	default:
+		fmt.Println(message)
+	}
+	return 0
+}
+
+func printJSON(v interface{}) {
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	out.Encode(v)
+}
+
+func printStatus(status server.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "host\t%s, vili up %s\n", status.Hostname, status.Uptime.Round(time.Second))
+	printVersion(w, "running", "", status.Running)
+	printVersion(w, "testing", fmt.Sprintf(" for %s, %d windows", status.TestingDuration.Round(time.Second), len(status.TestWindows)), status.Testing)
+	printVersion(w, "previous", "", status.Previous)
+	switch {
+	case status.Score != nil:
+		fmt.Fprintf(w, "score\t%s\n", status.Score)
+	case status.ScoreError != "":
+		fmt.Fprintf(w, "score\t%s\n", status.ScoreError)
+	}
+	var promotion []string
+	if status.Frozen {
+		promotion = append(promotion, "frozen")
+	}
+	if status.HeldVersion != "" {
+		promotion = append(promotion, "holding "+status.HeldVersion)
+	}
+	if status.Paused {
+		promotion = append(promotion, "paused")
+	}
+	if status.AwaitingApproval {
+		promotion = append(promotion, "awaiting approval")
+	}
+	if status.WaitingForWindow {
+		promotion = append(promotion, "waiting for deploy window")
+	}
+	if len(promotion) > 0 {
+		fmt.Fprintf(w, "promotion\t%s\n", strings.Join(promotion, ", "))
+	}
+	w.Flush()
+}
+
+func printVersion(w io.Writer, name, details string, vs *server.VersionStatus) {
+	if vs == nil {
+		fmt.Fprintf(w, "%s\tnone\n", name)
+		return
+	}
+	fmt.Fprintf(w, "%s\t%s%s\n", name, vs.Version, details)
+	fmt.Fprintln(w, "\tPORT\tPID\tREADY\tHEALTHY\tACTIVE\tUPTIME\tSTARTUP\tREQUESTS\tERRORS\tWARNINGS\tBREAKING")
+	for _, r := range vs.Replicas {
+		fmt.Fprintf(w, "\t%s\t%d\t%t\t%t\t%d\t%s\t%s\t%d\t%d\t%d\t%d\n", r.Port, r.Pid, r.Ready, r.Healthy, r.Active,
+			r.Uptime.Round(time.Second), r.StartupTime.Round(time.Millisecond), r.Counters.Requests, r.Counters.Errors, r.Counters.Warnings, r.Counters.Breaking)
+	}
+}
+
+func printHistory(events []eventlog.Event) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tVERSION\tFROM\tREASON")
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Time.Format("2006-01-02 15:04"), e.Type, e.Version, e.From, e.Message)
+	}
+	w.Flush()
+}
+
+func printEvents(events []eventlog.Event) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTYPE\tVERSION\tROLE\tPORT\tMESSAGE")
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Format("2006-01-02 15:04:05"), e.Type, e.Version, e.Role, e.Port, e.Message)
+	}
+	w.Flush()
+}
+
+func printArchives(archives []zip.Archive) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tARCHIVED\tSIZE")
+	for _, a := range archives {
+		fmt.Fprintf(w, "%s\t%s\t%.1fMB\n", a.Version, a.Archived.Format("2006-01-02 15:04"), float64(a.Size)/(1<<20))
+	}
+	w.Flush()
+}
+
+func printQuarantine(entries []quarantine.Entry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tQUARANTINED\tREASON")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.Version, e.Time.Format("2006-01-02 15:04"), e.Reason)
+	}
+	w.Flush()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cantara/vili/admin"
+)
+
+func TestCommandFromAnotherFolder(t *testing.T) {
+	t.Setenv("admin_socket", "")
+	os.Unsetenv("admin_socket") //So it is read from .env, t.Setenv puts it back
+	t.Setenv("vili_base", "")
+	base := t.TempDir()
+	err := os.WriteFile(filepath.Join(base, ".env"), []byte("admin_socket=control.sock\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(base, "control.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(admin.Response{Message: r.Method + " " + r.URL.Path})
+	})}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if code := runCommand([]string{"--base", base, "pause"}); code != 0 {
+		t.Errorf("vili --base %s pause exited with %d", base, code)
+	}
+	t.Setenv("vili_base", base)
+	if code := runCommand([]string{"resume"}); code != 0 {
+		t.Errorf("vili resume with vili_base exited with %d", code)
+	}
+	if socket := admin.SocketFromEnv(base); socket != filepath.Join(base, "control.sock") {
+		t.Errorf("Socket is %s, expected control.sock in the base folder", socket)
+	}
+}
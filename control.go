@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cantara/vili/server"
+	"github.com/cantara/vili/zip"
+)
+
+// control is what the admin api can do, the server plus the archive main owns.
+type control struct {
+	server.Server
+	archive zip.Zipper
+}
+
+func (c control) Archives() ([]zip.Archive, error) {
+	return c.archive.List()
+}
+
+func (c control) RollbackTo(version string, force bool) error {
+	err := validVersion(version)
+	if err != nil {
+		return err
+	}
+	return c.Restore(version, c.archive.Unzip, force)
+}
+
+// validVersion only lets version directories of this service in the base folder be rolled back to.
+func validVersion(version string) error {
+	if strings.ContainsAny(version, `/\`) || strings.Contains(version, "..") || !strings.HasPrefix(version, os.Getenv("identifier")+"-") {
+		return fmt.Errorf("Invalid version %q", version)
+	}
+	return nil
+}
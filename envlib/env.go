@@ -0,0 +1,60 @@
+package envlib
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/cantara/bragi"
+)
+
+func Int(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.AddError(err).Warning("Invalid int in env ", key, ", using default ", def)
+		return def
+	}
+	return i
+}
+
+func List(key string) (out []string) {
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		out = append(out, v)
+	}
+	return
+}
+
+func Float(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.AddError(err).Warning("Invalid float in env ", key, ", using default ", def)
+		return def
+	}
+	return f
+}
+
+func Duration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.AddError(err).Warning("Invalid duration in env ", key, ", using default ", def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,200 @@
+package eventlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/envlib"
+)
+
+type Type string
+
+const (
+	JAR_DETECTED      Type = "jar_detected"
+	STRUCTURE_CREATED Type = "structure_created"
+	SERVLET_STARTED   Type = "servlet_started"
+	SERVLET_READY     Type = "servlet_ready"
+	SERVLET_CRASHED   Type = "servlet_crashed"
+	SERVLET_KILLED    Type = "servlet_killed"
+	TEST_RESET        Type = "test_reset"
+	PROMOTED          Type = "promoted"
+	ABANDONED         Type = "abandoned"
+	ROLLEDBACK        Type = "rolled_back"
+	RESTORED          Type = "restored"
+	RESTARTED         Type = "restarted"
+	FROZEN            Type = "frozen"
+	UNFROZEN          Type = "unfrozen"
+	ARCHIVED          Type = "archived"
+	CLEANED_UP        Type = "cleaned_up"
+)
+
+// History is what vili history shows, the changes to which versions run.
+var History = []Type{PROMOTED, ABANDONED, ROLLEDBACK, RESTORED, RESTARTED}
+
+type Event struct {
+	Time    time.Time              `json:"time"`
+	Type    Type                   `json:"type"`
+	Version string                 `json:"version,omitempty"`
+	From    string                 `json:"from,omitempty"` //The version that was replaced
+	Role    string                 `json:"role,omitempty"`
+	Port    string                 `json:"port,omitempty"`
+	Message string                 `json:"message,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// Log is an append only json line file that is rotated to path.1, path.2 and so on when it grows past maxSize.
+type Log struct {
+	path    string
+	maxSize int64
+	keep    int
+	mutex   sync.Mutex
+}
+
+func Open(path string, maxSize int64, keep int) *Log {
+	return &Log{path: path, maxSize: maxSize, keep: keep}
+}
+
+// OpenFromEnv rotates at event_log_max_mb and keeps event_log_keep rotated files.
+func OpenFromEnv(path string) *Log {
+	return Open(path, int64(envlib.Int("event_log_max_mb", 10))<<20, envlib.Int("event_log_keep", 5))
+}
+
+func (l *Log) Record(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	err = l.rotate()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Add records e and logs it when it could not be recorded, for callers that carry on either way.
+func (l *Log) Add(e Event) {
+	err := l.Record(e)
+	if err != nil {
+		log.AddError(err).Warning("While recording ", e.Type, " event")
+	}
+}
+
+func (l *Log) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+func (l *Log) rotate() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if l.maxSize <= 0 || info.Size() < l.maxSize {
+		return nil
+	}
+	if l.keep < 1 {
+		return os.Remove(l.path)
+	}
+	os.Remove(l.rotated(l.keep))
+	for i := l.keep - 1; i > 0; i-- {
+		err = os.Rename(l.rotated(i), l.rotated(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(l.path, l.rotated(1))
+}
+
+// Filter selects events, zero values match everything. Limit keeps the newest events.
+type Filter struct {
+	Version string
+	Types   []Type
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+func (f Filter) match(e Event) bool {
+	if f.Version != "" && e.Version != f.Version {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the matching events oldest first, from the rotated files as well. Lines that can't be read are skipped.
+func (l *Log) Query(f Filter) (events []Event, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var paths []string
+	for i := l.keep; i > 0; i-- {
+		paths = append(paths, l.rotated(i))
+	}
+	paths = append(paths, l.path)
+	for _, path := range paths {
+		events, err = read(path, f, events)
+		if err != nil {
+			return
+		}
+		if f.Limit > 0 && len(events) > f.Limit {
+			events = events[len(events)-f.Limit:]
+		}
+	}
+	return
+}
+
+func read(path string, f Filter, events []Event) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return events, nil
+		}
+		return events, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if f.match(e) {
+			events = append(events, e)
+		}
+	}
+	return events, scanner.Err()
+}
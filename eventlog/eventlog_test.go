@@ -0,0 +1,94 @@
+package eventlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l := Open(path, 300, 2)
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		version := "app-1.0.0"
+		if i%2 == 1 {
+			version = "app-1.0.1"
+		}
+		typ := SERVLET_STARTED
+		if i%5 == 0 {
+			typ = TEST_RESET
+		}
+		if err := l.Record(Event{Time: start.Add(time.Duration(i) * time.Minute), Type: typ, Version: version, Message: "event"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Fatalf("Log was not rotated: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("Only two rotated files should be kept")
+	}
+
+	all, err := Open(path, 300, 2).Query(Filter{})
+	if err != nil || len(all) == 0 || len(all) >= 20 {
+		t.Fatalf("Query after rotation got %d events, %v", len(all), err)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Time.Before(all[i-1].Time) {
+			t.Fatalf("Events are not oldest first: %v", all)
+		}
+	}
+	newest := all[len(all)-1].Time
+
+	for _, tc := range []struct {
+		name   string
+		filter Filter
+		check  func(Event) bool
+		count  int
+	}{
+		{"version", Filter{Version: "app-1.0.1"}, func(e Event) bool { return e.Version == "app-1.0.1" }, -1},
+		{"type", Filter{Types: []Type{TEST_RESET}}, func(e Event) bool { return e.Type == TEST_RESET }, -1},
+		{"since", Filter{Since: newest.Add(-2 * time.Minute)}, func(e Event) bool { return !e.Time.Before(newest.Add(-2 * time.Minute)) }, 3},
+		{"until", Filter{Until: newest.Add(-time.Minute)}, func(e Event) bool { return !e.Time.After(newest.Add(-time.Minute)) }, len(all) - 1},
+		{"limit", Filter{Limit: 2}, func(e Event) bool { return !e.Time.Before(newest.Add(-time.Minute)) }, 2},
+	} {
+		events, err := l.Query(tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.count >= 0 && len(events) != tc.count {
+			t.Errorf("%s: got %d events, expected %d", tc.name, len(events), tc.count)
+		}
+		if len(events) == 0 {
+			t.Errorf("%s: no events", tc.name)
+		}
+		for _, e := range events {
+			if !tc.check(e) {
+				t.Errorf("%s: unexpected event %+v", tc.name, e)
+			}
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	l := Open(filepath.Join(t.TempDir(), "events.jsonl"), 1<<20, 1)
+	for _, e := range []Event{
+		{Type: SERVLET_STARTED, Version: "app-1.0.1"},
+		{Type: PROMOTED, Version: "app-1.0.1", From: "app-1.0.0", Message: "score 12.0"},
+		{Type: TEST_RESET, Version: "app-1.0.1"},
+		{Type: ROLLEDBACK, Version: "app-1.0.0", From: "app-1.0.1", Message: "breaking"},
+	} {
+		if err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := l.Query(Filter{Types: History})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Type != PROMOTED || events[0].From != "app-1.0.0" || events[1].Type != ROLLEDBACK || events[1].Message != "breaking" {
+		t.Errorf("History = %+v", events)
+	}
+}
@@ -0,0 +1,138 @@
+package fingerprint
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cantara/vili/envlib"
+)
+
+var (
+	exceptionRegex = regexp.MustCompile(`^(?:Exception in thread "[^"]*" |Caused by: )?((?:[a-zA-Z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error|Throwable))(?::|\s|$)`)
+	frameRegex     = regexp.MustCompile(`^\s+at\s+(?:[\w.-]+(?:@[\w.-]+)?/+)?([\w$.<>]+)\(`)
+	moreRegex      = regexp.MustCompile(`^\s+\.\.\. \d+ (?:more|common frames omitted)`)
+)
+
+var frameworkPackages = []string{"java.", "javax.", "jakarta.", "jdk.", "sun.", "com.sun.", "kotlin.", "scala.", "org.springframework.", "org.eclipse.jetty.", "org.apache.", "io.netty.", "reactor.", "org.glassfish.", "org.jboss.", "io.undertow."}
+
+type Fingerprint struct {
+	Id        string    `json:"id"`
+	Type      string    `json:"type"`
+	Frames    []string  `json:"frames"`
+	Count     int64     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+type Exception struct {
+	Type   string
+	Frames []string
+}
+
+// Config decides which frames make up a fingerprint.
+type Config struct {
+	Frames      int
+	AppPackages []string //Frames outside these packages are skipped, without them only known framework packages are
+}
+
+// ConfigFromEnv uses fingerprint_frames and fingerprint_app_packages.
+func ConfigFromEnv() Config {
+	return Config{
+		Frames:      envlib.Int("fingerprint_frames", 3),
+		AppPackages: envlib.List("fingerprint_app_packages"),
+	}
+}
+
+func (e Exception) Fingerprint(c Config) Fingerprint {
+	frames := applicationFrames(e.Frames, c.Frames, c.AppPackages)
+	sum := sha1.Sum([]byte(e.Type + "|" + strings.Join(frames, "|")))
+	return Fingerprint{
+		Id:     hex.EncodeToString(sum[:6]),
+		Type:   e.Type,
+		Frames: frames,
+	}
+}
+
+// applicationFrames keeps the top frames that belong to the application, line numbers are not part of frames so fingerprints survive unrelated code changes.
+func applicationFrames(frames []string, num int, appPackages []string) (out []string) {
+	for _, frame := range frames {
+		if len(out) >= num {
+			break
+		}
+		if isApplicationFrame(frame, appPackages) {
+			out = append(out, frame)
+		}
+	}
+	return
+}
+
+func isApplicationFrame(frame string, appPackages []string) bool {
+	if len(appPackages) > 0 {
+		for _, p := range appPackages {
+			if strings.HasPrefix(frame, p) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range frameworkPackages {
+		if strings.HasPrefix(frame, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Collector assembles stack traces that are spread over multiple log lines.
+type Collector struct {
+	current *Exception
+	inCause bool
+}
+
+func (c *Collector) Add(line string) (done *Exception) {
+	line = strings.TrimRight(line, "\r\n")
+	if c.current != nil {
+		if m := frameRegex.FindStringSubmatch(line); m != nil {
+			if !c.inCause {
+				c.current.Frames = append(c.current.Frames, m[1])
+			}
+			return
+		}
+		if moreRegex.MatchString(line) {
+			return
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "Caused by: ") || strings.HasPrefix(strings.TrimSpace(line), "Suppressed: ") {
+			c.inCause = true //Only the frames of the outermost exception are used
+			return
+		}
+		done = c.Flush()
+	}
+	if m := exceptionRegex.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+		c.current = &Exception{Type: m[1]}
+	}
+	return
+}
+
+func (c *Collector) Flush() (done *Exception) {
+	done, c.current, c.inCause = c.current, nil, false
+	return
+}
+
+func (c *Collector) Pending() bool {
+	return c.current != nil
+}
+
+func Parse(trace string) (exceptions []Exception) {
+	var c Collector
+	for _, line := range strings.Split(trace, "\n") {
+		if e := c.Add(line); e != nil {
+			exceptions = append(exceptions, *e)
+		}
+	}
+	if e := c.Flush(); e != nil {
+		exceptions = append(exceptions, *e)
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package fingerprint
+
+import (
+	"testing"
+)
+
+const trace = `2021-01-01 12:00:00 ERROR [main] com.acme.Service - Request failed
+java.lang.NullPointerException: Cannot invoke "String.length()" because "name" is null
+	at com.acme.users.UserService.lookup(UserService.java:42)
+	at com.acme.users.UserResource.get(UserResource.java:17)
+	at java.base/jdk.internal.reflect.NativeMethodAccessorImpl.invoke0(Native Method)
+	at org.springframework.web.method.support.InvocableHandlerMethod.doInvoke(InvocableHandlerMethod.java:205)
+Caused by: java.lang.IllegalStateException: nested
+	at com.acme.other.Thing.run(Thing.java:1)
+	... 12 more
+2021-01-01 12:00:01 INFO [main] com.acme.Service - Next request`
+
+func TestCollector(t *testing.T) {
+	exceptions := Parse(trace)
+	if len(exceptions) != 1 {
+		t.Fatalf("Expected one exception got %d: %+v", len(exceptions), exceptions)
+	}
+	e := exceptions[0]
+	if e.Type != "java.lang.NullPointerException" {
+		t.Errorf("Unexpected type %s", e.Type)
+	}
+	fp := e.Fingerprint(Config{Frames: 3})
+	expected := []string{"com.acme.users.UserService.lookup", "com.acme.users.UserResource.get"}
+	if len(fp.Frames) != len(expected) {
+		t.Fatalf("Unexpected frames %v", fp.Frames)
+	}
+	for i := range expected {
+		if fp.Frames[i] != expected[i] {
+			t.Errorf("Frame %d %s != %s", i, fp.Frames[i], expected[i])
+		}
+	}
+}
+
+func TestFingerprintIgnoresLineNumbers(t *testing.T) {
+	a := Parse("java.lang.IllegalArgumentException: a\n\tat com.acme.A.b(A.java:1)")
+	b := Parse("java.lang.IllegalArgumentException: b\n\tat com.acme.A.b(A.java:99)")
+	c := Parse("java.lang.IllegalStateException: a\n\tat com.acme.A.b(A.java:1)")
+	c3 := Config{Frames: 3}
+	if a[0].Fingerprint(c3).Id != b[0].Fingerprint(c3).Id {
+		t.Error("Same exception on different line numbers got different fingerprints")
+	}
+	if a[0].Fingerprint(c3).Id == c[0].Fingerprint(c3).Id {
+		t.Error("Different exception types got the same fingerprint")
+	}
+}
+
+func TestCollectorPending(t *testing.T) {
+	var c Collector
+	if c.Add("java.io.IOException: closed") != nil {
+		t.Error("Exception completed before it ended")
+	}
+	if c.Add("\tat com.acme.A.b(A.java:1)") != nil {
+		t.Error("Exception completed on a frame")
+	}
+	if !c.Pending() {
+		t.Error("Collector is not pending with an open exception")
+	}
+	e := c.Flush()
+	if e == nil || len(e.Frames) != 1 {
+		t.Errorf("Unexpected flushed exception %+v", e)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("fingerprint_frames", "1")
+	t.Setenv("fingerprint_app_packages", "com.acme.users.")
+	c := ConfigFromEnv()
+	t.Setenv("fingerprint_frames", "5")
+	fp := Parse(trace)[0].Fingerprint(c)
+	if len(fp.Frames) != 1 || fp.Frames[0] != "com.acme.users.UserService.lookup" {
+		t.Errorf("Unexpected frames %v", fp.Frames)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -51,7 +52,7 @@ func CreateNewServerInstanceStructure(serverDir fslib.Dir, t typelib.ServerType,
 		err = fmt.Errorf("Server file does not excist in server folder, thus unable to create new instance structure: err(%v) %s", err, outerServerFile.Name())
 		return
 	}
-	newInstancePath := fmt.Sprintf("%s_%s", time.Now().Format("2006-01-02_15.04.05"), t) //, numRestartsOfType(server, t)+1)
+	newInstancePath := fmt.Sprintf("%s_%s_%s", time.Now().Format("2006-01-02_15.04.05"), t, port) //Port is included so replicas started in the same second get separate instances
 	instanceDir, err = serverDir.Mkdir(newInstancePath, 0755)
 	if err != nil {
 		return
@@ -93,17 +94,20 @@ func CreateNewServerInstanceStructure(serverDir fslib.Dir, t typelib.ServerType,
 	return
 }
 
-func GetFirstServerDir(t typelib.ServerType) (serverDir fslib.Dir, err error) {
+// GetFirstServerDir finds the version to start as t, versions skip returns true for are never used.
+func GetFirstServerDir(t typelib.ServerType, skip func(version string) bool) (serverDir fslib.Dir, err error) {
 	fileName := fmt.Sprintf("%s-%s", os.Getenv("identifier"), t)
 	if baseDir.Exists(fileName) {
 		name, err := baseDir.Readlink(fileName)
-		if err == nil {
+		if err == nil && skip(filepath.Base(name)) {
+			log.Info("Not starting quarantined ", name, " as ", t)
+		} else if err == nil {
 			serverDir, err = baseDir.Cd(name)
 			return serverDir, err
 		}
 		log.Println(err)
 	}
-	name, err := getNewestServerDir(t)
+	name, err := getNewestServerDir(t, skip)
 	if err != nil {
 		return
 	}
@@ -116,7 +120,7 @@ func GetFirstServerDir(t typelib.ServerType) (serverDir fslib.Dir, err error) {
 	return
 }
 
-func getNewestServerDir(t typelib.ServerType) (serverDir fslib.Dir, err error) {
+func getNewestServerDir(t typelib.ServerType, skip func(version string) bool) (serverDir fslib.Dir, err error) {
 	files, err := baseDir.Readdir(".")
 	if err != nil {
 		return
@@ -131,6 +135,9 @@ func getNewestServerDir(t typelib.ServerType) (serverDir fslib.Dir, err error) {
 		if file.Name() == os.Getenv("identifier")+".jar" {
 			continue
 		}
+		if skip(file.Name()) || (!file.IsDir() && skip(stripJar(file.Name()))) {
+			continue
+		}
 		if file.IsDir() {
 			if nameDir != "" && isSemanticNewer("*.*.*", toVersion(file.Name()), toVersion(nameDir)) { //timeDir.After(file.ModTime()) {
 				continue
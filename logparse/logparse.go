@@ -0,0 +1,265 @@
+package logparse
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type Level int
+
+const (
+	UNKNOWN Level = iota
+	TRACE
+	DEBUG
+	INFO
+	WARN
+	ERROR
+)
+
+func (l Level) String() string {
+	return []string{"unknown", "trace", "debug", "info", "warn", "error"}[l]
+}
+
+func LevelFromString(s string) Level {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "TRACE", "FINEST", "FINER":
+		return TRACE
+	case "DEBUG", "FINE":
+		return DEBUG
+	case "INFO", "NOTICE":
+		return INFO
+	case "WARN", "WARNING":
+		return WARN
+	case "ERROR", "ERR", "SEVERE", "FATAL", "CRIT", "CRITICAL":
+		return ERROR
+	}
+	return UNKNOWN
+}
+
+type Entry struct {
+	Level      Level
+	Logger     string
+	Message    string
+	StackTrace string
+	Raw        []byte
+}
+
+type Parser interface {
+	Parse(line []byte) (Entry, error)
+}
+
+type Source struct {
+	Path   string
+	Parser Parser
+}
+
+type fields struct {
+	level      string
+	message    string
+	logger     string
+	stackTrace string
+}
+
+func (f fields) withEnv() fields {
+	if v := os.Getenv("log_level_field"); v != "" {
+		f.level = v
+	}
+	if v := os.Getenv("log_message_field"); v != "" {
+		f.message = v
+	}
+	if v := os.Getenv("log_logger_field"); v != "" {
+		f.logger = v
+	}
+	if v := os.Getenv("log_stack_trace_field"); v != "" {
+		f.stackTrace = v
+	}
+	return f
+}
+
+const DefaultSources = "json:logs/json/{identifier}.log"
+
+// SourcesFromEnv reads log_sources as a comma separated list of <format>:<path>, where path is relative to the instance dir.
+func SourcesFromEnv() (sources []Source, err error) {
+	conf := os.Getenv("log_sources")
+	if strings.TrimSpace(conf) == "" {
+		conf = DefaultSources
+	}
+	for _, s := range strings.Split(conf, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		format, path, found := strings.Cut(s, ":")
+		if !found {
+			err = fmt.Errorf("Log source %s is not in the format <format>:<path>", s)
+			return
+		}
+		var p Parser
+		p, err = NewParser(format)
+		if err != nil {
+			return
+		}
+		sources = append(sources, Source{
+			Path:   strings.ReplaceAll(path, "{identifier}", os.Getenv("identifier")),
+			Parser: p,
+		})
+	}
+	return
+}
+
+func NewParser(format string) (Parser, error) {
+	switch strings.ToLower(format) {
+	case "json", "logstash":
+		return jsonParser{fields: fields{level: "level", message: "message", logger: "logger_name", stackTrace: "stack_trace"}.withEnv()}, nil
+	case "ecs":
+		return jsonParser{fields: fields{level: "log.level", message: "message", logger: "log.logger", stackTrace: "error.stack_trace"}.withEnv()}, nil
+	case "logfmt":
+		return logfmtParser{fields: fields{level: "level", message: "msg", logger: "logger"}.withEnv()}, nil
+	case "text", "plain":
+		return NewTextParser(os.Getenv("log_level_regex"))
+	}
+	return nil, fmt.Errorf("Unknown log format %s", format)
+}
+
+type jsonParser struct {
+	fields fields
+}
+
+func (p jsonParser) Parse(line []byte) (e Entry, err error) {
+	var data map[string]interface{}
+	err = json.Unmarshal(line, &data)
+	if err != nil {
+		return
+	}
+	e = Entry{
+		Level:      LevelFromString(lookup(data, p.fields.level)),
+		Logger:     lookup(data, p.fields.logger),
+		Message:    lookup(data, p.fields.message),
+		StackTrace: lookup(data, p.fields.stackTrace),
+		Raw:        line,
+	}
+	return
+}
+
+// lookup supports both flat keys containing dots, as ECS writes them, and nested objects.
+func lookup(data map[string]interface{}, key string) string {
+	if v, ok := data[key]; ok {
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+	first, rest, found := strings.Cut(key, ".")
+	if !found {
+		return ""
+	}
+	nested, ok := data[first].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	return lookup(nested, rest)
+}
+
+type logfmtParser struct {
+	fields fields
+}
+
+func (p logfmtParser) Parse(line []byte) (e Entry, err error) {
+	data := parseLogfmt(strings.TrimSpace(string(line)))
+	if len(data) == 0 {
+		err = fmt.Errorf("No logfmt pairs in line")
+		return
+	}
+	e = Entry{
+		Level:   LevelFromString(data[p.fields.level]),
+		Logger:  data[p.fields.logger],
+		Message: data[p.fields.message],
+		Raw:     line,
+	}
+	return
+}
+
+func parseLogfmt(line string) map[string]string {
+	data := make(map[string]string)
+	for len(line) > 0 {
+		line = strings.TrimLeft(line, " \t")
+		eq := strings.IndexAny(line, "= \t")
+		if eq < 0 {
+			data[line] = ""
+			break
+		}
+		key := line[:eq]
+		if line[eq] != '=' {
+			data[key] = ""
+			line = line[eq:]
+			continue
+		}
+		line = line[eq+1:]
+		var val string
+		if strings.HasPrefix(line, `"`) {
+			end := 1
+			for end < len(line) && (line[end] != '"' || line[end-1] == '\\') {
+				end++
+			}
+			val = strings.ReplaceAll(line[1:min(end, len(line))], `\"`, `"`)
+			line = line[min(end+1, len(line)):]
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			val = line[:end]
+			line = line[end:]
+		}
+		if key != "" {
+			data[key] = val
+		}
+	}
+	return data
+}
+
+const DefaultLevelRegex = `\b(TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL)\b`
+
+type textParser struct {
+	regex *regexp.Regexp
+}
+
+// NewTextParser uses the named groups level, logger and message if present, otherwise the first group is used as level.
+func NewTextParser(levelRegex string) (Parser, error) {
+	if levelRegex == "" {
+		levelRegex = DefaultLevelRegex
+	}
+	r, err := regexp.Compile(levelRegex)
+	if err != nil {
+		return nil, err
+	}
+	return textParser{regex: r}, nil
+}
+
+func (p textParser) Parse(line []byte) (e Entry, err error) {
+	e = Entry{
+		Message: strings.TrimRight(string(line), "\r\n"),
+		Raw:     line,
+	}
+	match := p.regex.FindSubmatch(line)
+	if match == nil {
+		return
+	}
+	for i, name := range p.regex.SubexpNames() {
+		switch name {
+		case "level":
+			e.Level = LevelFromString(string(match[i]))
+		case "logger":
+			e.Logger = string(match[i])
+		case "message":
+			e.Message = string(match[i])
+		}
+	}
+	if e.Level == UNKNOWN && len(match) > 1 {
+		e.Level = LevelFromString(string(match[1]))
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package logparse
+
+import (
+	"testing"
+)
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		line    string
+		level   Level
+		logger  string
+		message string
+	}{
+		{"json upper case", "json", `{"level":"ERROR","logger_name":"a.b","message":"boom"}`, ERROR, "a.b", "boom"},
+		{"json warn", "json", `{"level":"WARN","message":"hmm"}`, WARN, "", "hmm"},
+		{"ecs flat lower case", "ecs", `{"log.level":"error","log.logger":"a.b","message":"boom"}`, ERROR, "a.b", "boom"},
+		{"ecs nested", "ecs", `{"log":{"level":"warn","logger":"a.b"},"message":"hmm"}`, WARN, "a.b", "hmm"},
+		{"logfmt", "logfmt", `ts=2021-01-01 level=error logger=a.b msg="something \"bad\" happened"`, ERROR, "a.b", `something "bad" happened`},
+		{"logfmt warning", "logfmt", `level=warning msg=hmm`, WARN, "", "hmm"},
+		{"text default regex", "text", `2021-01-01 12:00:00 ERROR [main] a.b - boom`, ERROR, "", `2021-01-01 12:00:00 ERROR [main] a.b - boom`},
+		{"text no level", "text", `	at a.b.C.d(C.java:12)`, UNKNOWN, "", `	at a.b.C.d(C.java:12)`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := NewParser(test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := p.Parse([]byte(test.line))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Level != test.level {
+				t.Errorf("level %s != %s", e.Level, test.level)
+			}
+			if e.Logger != test.logger {
+				t.Errorf("logger %q != %q", e.Logger, test.logger)
+			}
+			if e.Message != test.message {
+				t.Errorf("message %q != %q", e.Message, test.message)
+			}
+		})
+	}
+}
+
+func TestTextParserNamedGroups(t *testing.T) {
+	p, err := NewTextParser(`^\S+ \[(?P<level>\w+)\] (?P<logger>\S+): (?P<message>.*)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := p.Parse([]byte("12:00 [warning] a.b: careful"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Level != WARN || e.Logger != "a.b" || e.Message != "careful" {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+}
+
+func TestSourcesFromEnv(t *testing.T) {
+	t.Setenv("identifier", "something")
+	t.Setenv("log_sources", "")
+	sources, err := SourcesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0].Path != "logs/json/something.log" {
+		t.Errorf("Unexpected default sources %+v", sources)
+	}
+
+	t.Setenv("log_sources", "ecs:logs/ecs.log, text:stdErr")
+	sources, err = SourcesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 || sources[1].Path != "stdErr" {
+		t.Errorf("Unexpected sources %+v", sources)
+	}
+
+	t.Setenv("log_sources", "yaml:logs/app.log")
+	_, err = SourcesFromEnv()
+	if err == nil {
+		t.Error("No error for unknown log format")
+	}
+}
@@ -0,0 +1,138 @@
+package logrules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/cantara/vili/logparse"
+)
+
+type Action int
+
+const (
+	WEIGHT Action = iota
+	IGNORE
+	FAIL
+)
+
+func (a Action) String() string {
+	return []string{"weight", "ignore", "fail"}[a]
+}
+
+func ActionFromString(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case WEIGHT.String(), "increment":
+		return WEIGHT, nil
+	case IGNORE.String():
+		return IGNORE, nil
+	case FAIL.String(), "instant-fail", "instant_fail":
+		return FAIL, nil
+	}
+	return WEIGHT, fmt.Errorf("Unknown log rule action %s", s)
+}
+
+type Rule struct {
+	Name            string `json:"name"`
+	Level           string `json:"level"`
+	Logger          string `json:"logger"`
+	MessageContains string `json:"message_contains"`
+	MessageMatches  string `json:"message_matches"`
+	Action          string `json:"action"`
+	Weight          int64  `json:"weight"`
+
+	action  Action
+	level   logparse.Level
+	matches *regexp.Regexp
+}
+
+type Rules []Rule
+
+const DefaultFile = "log_rules.json"
+
+// FromEnv reads the rules file given by log_rules_file, relative to the base dir. A missing file means no rules.
+func FromEnv() (Rules, error) {
+	path := os.Getenv("log_rules_file")
+	if path == "" {
+		path = DefaultFile
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (rules Rules, err error) {
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return
+	}
+	for i := range rules {
+		r := &rules[i]
+		r.action, err = ActionFromString(r.Action)
+		if err != nil {
+			return
+		}
+		if r.Level != "" {
+			r.level = logparse.LevelFromString(r.Level)
+			if r.level == logparse.UNKNOWN {
+				err = fmt.Errorf("Unknown level %s in log rule %d", r.Level, i)
+				return
+			}
+		}
+		if r.MessageMatches != "" {
+			r.matches, err = regexp.Compile(r.MessageMatches)
+			if err != nil {
+				return
+			}
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i)
+		}
+	}
+	return
+}
+
+// Match returns the first rule matching the entry, or nil.
+func (rules Rules) Match(e logparse.Entry) *Rule {
+	for i := range rules {
+		if rules[i].matchesEntry(e) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func (r Rule) matchesEntry(e logparse.Entry) bool {
+	if r.level != logparse.UNKNOWN && r.level != e.Level {
+		return false
+	}
+	if r.Logger != "" {
+		if prefix, ok := strings.CutSuffix(r.Logger, "*"); ok {
+			if !strings.HasPrefix(e.Logger, prefix) {
+				return false
+			}
+		} else if r.Logger != e.Logger {
+			return false
+		}
+	}
+	if r.MessageContains != "" && !strings.Contains(e.Message, r.MessageContains) && !strings.Contains(e.StackTrace, r.MessageContains) {
+		return false
+	}
+	if r.matches != nil && !r.matches.MatchString(e.Message) {
+		return false
+	}
+	return true
+}
+
+func (r Rule) Act() Action {
+	return r.action
+}
@@ -0,0 +1,64 @@
+package logrules
+
+import (
+	"testing"
+
+	"github.com/cantara/vili/logparse"
+)
+
+const rulesFile = `[
+	{"name": "oom", "message_contains": "OutOfMemoryError", "action": "fail"},
+	{"logger": "com.acme.audit", "level": "ERROR", "action": "weight", "weight": 50},
+	{"logger": "com.acme.legacy.*", "action": "ignore"},
+	{"message_matches": "(?i)deprecated", "action": "ignore"}
+]`
+
+func TestMatch(t *testing.T) {
+	rules, err := Parse([]byte(rulesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		entry  logparse.Entry
+		rule   string
+		action Action
+	}{
+		{"instant fail", logparse.Entry{Level: logparse.ERROR, Message: "java.lang.OutOfMemoryError: Java heap space"}, "oom", FAIL},
+		{"weighted logger", logparse.Entry{Level: logparse.ERROR, Logger: "com.acme.audit"}, "rule 1", WEIGHT},
+		{"wrong level", logparse.Entry{Level: logparse.WARN, Logger: "com.acme.audit"}, "", WEIGHT},
+		{"logger prefix", logparse.Entry{Level: logparse.ERROR, Logger: "com.acme.legacy.Old"}, "rule 2", IGNORE},
+		{"regex", logparse.Entry{Level: logparse.WARN, Message: "This API is Deprecated"}, "rule 3", IGNORE},
+		{"no match", logparse.Entry{Level: logparse.ERROR, Message: "boom"}, "", WEIGHT},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule := rules.Match(test.entry)
+			if test.rule == "" {
+				if rule != nil {
+					t.Errorf("Expected no match, got %s", rule.Name)
+				}
+				return
+			}
+			if rule == nil {
+				t.Fatalf("Expected %s to match", test.rule)
+			}
+			if rule.Name != test.rule || rule.Act() != test.action {
+				t.Errorf("Got %s %s, expected %s %s", rule.Name, rule.Act(), test.rule, test.action)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{
+		`[{"action": "explode"}]`,
+		`[{"level": "LOUD", "action": "ignore"}]`,
+		`[{"message_matches": "(", "action": "ignore"}]`,
+	} {
+		_, err := Parse([]byte(data))
+		if err == nil {
+			t.Errorf("No error when parsing %s", data)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,15 +10,22 @@ import (
 	stdFs "io/fs"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/admin"
+	"github.com/cantara/vili/eventlog"
 	"github.com/cantara/vili/fs"
 	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/metrics"
+	"github.com/cantara/vili/route"
 	"github.com/cantara/vili/server"
 	"github.com/cantara/vili/slack"
+	"github.com/cantara/vili/tracing"
 	"github.com/cantara/vili/typelib"
 	"github.com/cantara/vili/zip"
 	"github.com/joho/godotenv"
@@ -27,6 +35,8 @@ import (
 type endpointToVerify struct {
 	oldResponse *http.Response
 	request     *http.Request
+	span        tracing.SpanContext //The proxied request, shadows are its children
+	upstream    tracing.SpanContext //The call to running the shadows are linked to
 }
 
 type viliDashAction struct {
@@ -35,7 +45,9 @@ type viliDashAction struct {
 }
 
 var endpoint string
+var routes route.Templates
 var z zip.Zipper
+var tracer *tracing.Tracer
 
 func loadEnv() {
 	err := godotenv.Load(".env")
@@ -64,6 +76,9 @@ func verifyConfig() error {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 	loadEnv()
 
 	logDir := os.Getenv("log_dir")
@@ -107,8 +122,12 @@ func main() {
 	z = zip.Zipper{
 		Dir: archiveDir,
 	}
+	events := eventlog.OpenFromEnv(wd.Path() + "/events.jsonl")
 
 	endpoint = os.Getenv("endpoint")
+	routes = route.TemplatesFromEnv()
+	tracer = tracing.FromEnv()
+	defer tracer.Shutdown()
 	r := os.Getenv("port_range")
 	ports := strings.Split(r, "-")
 	from, err := strconv.Atoi(ports[0])
@@ -123,54 +142,66 @@ func main() {
 	go func() {
 		for {
 			oldFolder := <-zipperChan
+			version := oldFolder.File().Name()
 			err = z.ZipDir(oldFolder)
 			if err != nil {
 				log.Println(err)
+			} else {
+				events.Add(eventlog.Event{Type: eventlog.ARCHIVED, Version: version})
 			}
 			for archiveDir.Size() > 1<<30 {
 				go slack.Sendf("Archive too large, cleaning up on server: %s.", hostname)
-				archiveDir.RemoveAll(fs.GetOldestFile(archiveDir))
+				oldest := fs.GetOldestFile(archiveDir)
+				err = archiveDir.RemoveAll(oldest)
+				if err != nil {
+					log.AddError(err).Error("While cleaning up archive")
+					break
+				}
+				events.Add(eventlog.Event{Type: eventlog.CLEANED_UP, Version: strings.TrimSuffix(oldest, ".zip"), Message: "archive too large"})
 			}
 		}
 	}()
 
 	verifyChan := make(chan endpointToVerify, 10) // Arbitrary large number that hopefully will not block
-	serv, err := server.Initialize(&wd, zipperChan, from, to)
+	registerMetrics(verifyChan)
+	serv, err := server.Initialize(&wd, zipperChan, from, to, events)
 	if err != nil {
 		slack.Sendf(":sos: <!channel> Uable to initialize vili on host %s.", hostname)
 		log.AddError(err).Fatal("While inizalicing server")
 	}
 	defer serv.Kill()
+	stopAdmin, err := admin.Serve(control{Server: serv, archive: z}, admin.SocketFromEnv(wd.Path()), os.Getenv("admin_addr"), os.Getenv("admin_token"))
+	if err != nil {
+		log.AddError(err).Error("While starting admin api, approve and reject is only possible from vili-dash")
+	} else {
+		defer stopAdmin()
+	}
 	go slack.Sendf(" :white_check_mark: Vili started initial services on host: %s, with running version %s.", hostname, serv.GetRunningVersion())
 
 	go func() {
 		for {
 			etv := <-verifyChan
-			if serv.HasTesting() {
-				go func() {
-					rNew, err := requestHandler(endpoint+":"+serv.GetPortTesting(), etv.request, serv, true)
-					if err != nil {
-						log.AddError(err).Warning("Error from testing server when verifying request")
-						return
-					}
-					defer rNew.Body.Close()
-					err = verifyNewResponse(etv.oldResponse, rNew)
-					if err != nil {
-						serv.AddBreaking()
-					}
-					serv.AddRequestTesting()
-					serv.CheckReliability(hostname)
-					if time.Minute*15 <= serv.TestingDuration() {
-						score, err := serv.ReliabilityScore()
-						if err != nil {
-							log.AddError(err).Debug("While checking reliability")
+			hasTesting, hasPrevious := serv.HasTesting(), serv.HasPrevious()
+			if !hasTesting && !hasPrevious {
+				continue
+			}
+			go func() { //Shadowing is sequential since the request body is reread for every shadow
+				if hasTesting {
+					requestRoute, breaking, ok := shadow(serv, etv, typelib.TESTING)
+					if ok {
+						if breaking {
+							serv.AddBreaking(requestRoute)
 						}
-						go slack.Sendf(" :recycle: :clock12: Vili restarting test on host: %s, with running version %s and testing version %s after %s with reliabily score %d(%v).",
-							hostname, serv.GetRunningVersion(), serv.GetTestingVersion(), serv.TestingDuration(), score, err)
-						serv.ResetTest()
+						serv.CheckReliability(hostname)
 					}
-				}()
-			}
+				}
+				if hasPrevious {
+					requestRoute, breaking, ok := shadow(serv, etv, typelib.PREVIOUS)
+					if ok && breaking {
+						serv.AddWatchBreaking(requestRoute)
+					}
+				}
+			}()
 		}
 	}()
 
@@ -206,7 +237,16 @@ func main() {
 				if name == serv.GetRunningVersion() {
 					continue
 				}
+				events.Add(eventlog.Event{Type: eventlog.JAR_DETECTED, Version: strings.TrimSuffix(path[len(path)-1], ".jar"), Message: ev.Name})
+				if serv.Quarantined(path[len(path)-1]) {
+					log.Info("Not testing quarantined version ", path[len(path)-1])
+					continue
+				}
 				time.Sleep(time.Second * 10) //Sleep an arbitrary amout of time so the file is done writing before we try to execute it
+				if serv.Frozen() {
+					serv.NewTesting(ev.Name) //Only copied and held, the server announces it
+					continue
+				}
 				go slack.Sendf(" :mailbox_with_mail: :clock12: New version found, downloaded and deployed, running version is: %s, starting to test version %s.", serv.GetRunningVersion(), name)
 				serv.NewTesting(ev.Name)
 			case err := <-watcher.Error:
@@ -229,7 +269,10 @@ func main() {
 			TestingV: "unknown",
 		}
 		go func() {
-			viliDashBaseURI := "https://api-devtest.entraos.io/vili-dash"
+			viliDashBaseURI := os.Getenv("vili_dash_uri")
+			if viliDashBaseURI == "" {
+				viliDashBaseURI = "https://api-devtest.entraos.io/vili-dash"
+			}
 			err = post(viliDashBaseURI+"/register/server", &servData, &servData)
 			for err != nil {
 				log.Info(err)
@@ -246,13 +289,19 @@ func main() {
 				}
 				switch vda.Action {
 				case "deploy":
-					serv.Deploy()
+					err = serv.Approve()
+					if err != nil {
+						log.AddError(err).Info("Manual deploy")
+					}
 				case "restart":
 					switch typelib.FromString(vda.Server) {
 					case typelib.RUNNING:
-						serv.RestartRunning()
+						err = serv.RestartRunning()
 					case typelib.TESTING:
-						serv.RestartTesting()
+						err = serv.RestartTesting()
+					}
+					if err != nil {
+						log.AddError(err).Info("Manual restart")
 					}
 				}
 			}
@@ -266,8 +315,45 @@ func main() {
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		sig := <-stop
+		log.Info("Stopping on ", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		s.Shutdown(ctx)
+	}()
 	log.Println(s.Addr + "/*")
-	log.Fatal(s.ListenAndServe())
+	err = s.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return //The deferred shutdowns export the remaining spans and stop the servlets
+	}
+	tracer.Shutdown()
+	log.Fatal(err)
+}
+
+func registerMetrics(verifyChan chan endpointToVerify) {
+	metrics.Register(
+		metrics.NewGauge("vili_shadow_queue_length", "Requests waiting to be shadowed.", func() float64 {
+			return float64(len(verifyChan))
+		}),
+		metrics.NewGauge("vili_shadow_queue_capacity", "Requests that can wait to be shadowed before proxying blocks.", func() float64 {
+			return float64(cap(verifyChan))
+		}),
+		metrics.NewGauge("vili_archived_versions", "Versions in the archive.", func() float64 {
+			archives, _ := z.List()
+			return float64(len(archives))
+		}),
+		metrics.NewGauge("vili_archive_bytes", "Total size of the archive.", func() float64 {
+			archives, _ := z.List()
+			var size int64
+			for _, a := range archives {
+				size += a.Size
+			}
+			return float64(size)
+		}),
+	)
 }
 
 func get(uri string, out interface{}) (err error) {
@@ -302,12 +388,26 @@ func post(uri string, data interface{}, out interface{}) (err error) {
 
 func reqHandler(serv server.Server, etv chan<- endpointToVerify) http.HandlerFunc { //TODO Remove dependencie on pointer
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !serv.HasRunning() {
+		requestRoute := routes.Route(r.Method, r.URL.Path)
+		incoming, _ := tracing.ParseTraceParent(r.Header.Get("traceparent"))
+		span := tracer.Start("vili "+requestRoute, tracing.Server, incoming)
+		defer span.End()
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("http.route", requestRoute)
+		upstream, err := serv.Acquire(typelib.RUNNING)
+		if err != nil {
 			log.Println("Missing running")
+			span.SetError(err)
 			return
 		}
-		respDep, err := requestHandler(endpoint+":"+serv.GetPortRunning(), r, serv, false)
+		upstreamSpan := tracer.Start(typelib.RUNNING.String()+" "+requestRoute, tracing.Client, span.Context())
+		start := time.Now()
+		respDep, err := requestHandler(endpoint+":"+upstream.Port(), r, false, upstreamSpan.Context())
+		upstream.Done(observation(requestRoute, start, respDep), err)
+		endSpan(upstreamSpan, serv, typelib.RUNNING, upstream.Port(), respDep, err)
 		if err != nil {
+			span.SetError(err)
 			log.AddError(err).Info("While proxying to running")
 			return
 		}
@@ -321,6 +421,7 @@ func reqHandler(serv server.Server, etv chan<- endpointToVerify) http.HandlerFun
 		}
 		fmt.Println("Headers: ", headers)
 		w.WriteHeader(respDep.StatusCode)
+		span.SetAttribute("http.response.status_code", respDep.StatusCode)
 		for key, vals := range respDep.Trailer {
 			for _, val := range vals {
 				w.Header().Add(key, val)
@@ -328,18 +429,19 @@ func reqHandler(serv server.Server, etv chan<- endpointToVerify) http.HandlerFun
 		}
 		io.Copy(w, respDep.Body)
 		respDep.Body.Close()
-		serv.AddRequestRunning()
 
 		if r.Method == "GET" || r.Method == "PUT" || r.Method == "PATCH" {
 			etv <- endpointToVerify{
 				oldResponse: respDep,
 				request:     r,
+				span:        span.Context(),
+				upstream:    upstreamSpan.Context(),
 			}
 		}
 	}
 }
 
-func requestHandler(host string, r *http.Request, serv server.Server, test bool) (*http.Response, error) { // Return response
+func requestHandler(host string, r *http.Request, test bool, sc tracing.SpanContext) (*http.Response, error) { // Return response
 	r.URL.Scheme = os.Getenv("scheme")
 	r.URL.Host = host
 	var body io.ReadCloser
@@ -351,11 +453,16 @@ func requestHandler(host string, r *http.Request, serv server.Server, test bool)
 			body = io.NopCloser(bytes.NewReader(contents))
 		}
 	}
+	header := r.Header
+	if sc.IsValid() { //The servlet continues the trace from the span of this call
+		header = r.Header.Clone()
+		header.Set("traceparent", sc.TraceParent())
+	}
 	req := &http.Request{
 		Method: r.Method,
 		URL:    r.URL, //strings.Replace(*r.URL, strings.Split(*r.URL, "/")[0], endpoint),
 		Body:   body,
-		Header: r.Header,
+		Header: header,
 		//		ContentLenght:    r.ContentLenght,
 		TransferEncoding: r.TransferEncoding,
 		Close:            true,
@@ -375,18 +482,82 @@ func requestHandler(host string, r *http.Request, serv server.Server, test bool)
 		if !strings.HasSuffix(r.URL.String(), "health") {
 			log.Printf("%s %s %s", prefix, resp.Status, r.URL)
 		}
+	}
+	return resp, e
+}
+
+// shadow sends a copy of the request to t and compares the response with the one from running.
+func shadow(serv server.Server, etv endpointToVerify, t typelib.ServerType) (requestRoute string, breaking, ok bool) {
+	upstream, err := serv.Acquire(t)
+	if err != nil {
+		log.AddError(err).Debug("No ", t, " server to verify request against")
+		return
+	}
+	requestRoute = routes.Route(etv.request.Method, etv.request.URL.Path)
+	span := tracer.Start("shadow "+t.String()+" "+requestRoute, tracing.Client, etv.span, etv.upstream)
+	start := time.Now()
+	resp, err := requestHandler(endpoint+":"+upstream.Port(), etv.request, true, span.Context())
+	upstream.Done(observation(requestRoute, start, resp), err)
+	endSpan(span, serv, t, upstream.Port(), resp, err)
+	if err != nil {
+		log.AddError(err).Warning("Error from ", t, " server when verifying request")
+		return
+	}
+	defer resp.Body.Close()
+	mismatch := server.Mismatch{
+		Role:     t.String(),
+		Version:  serv.GetTestingVersion(),
+		Method:   etv.request.Method,
+		Path:     etv.request.URL.Path,
+		Route:    requestRoute,
+		Expected: etv.oldResponse.StatusCode,
+		Got:      resp.StatusCode,
+		TraceID:  span.Context().TraceIDString(),
+	}
+	if t == typelib.PREVIOUS { //Previous is the known good version, so running is the one that breaks
+		breaking = verifyNewResponse(resp, etv.oldResponse) != nil
+		mismatch.Role, mismatch.Version = typelib.RUNNING.String(), serv.GetRunningVersion()
+		mismatch.Expected, mismatch.Got = resp.StatusCode, etv.oldResponse.StatusCode
 	} else {
-		if !test {
-			if !serv.IsRunningRunning() {
-				serv.RestartRunning()
-			}
-		} else {
-			if !serv.IsTestingRunning() {
-				serv.RestartTesting()
-			}
+		breaking = verifyNewResponse(etv.oldResponse, resp) != nil
+	}
+	span.SetAttribute("vili.breaking", breaking)
+	if breaking {
+		serv.AddMismatch(mismatch)
+	}
+	return requestRoute, breaking, true
+}
+
+// endSpan ends the span of a call to a servlet, the version makes failures in testing easy to find.
+func endSpan(span *tracing.Span, serv server.Server, t typelib.ServerType, port string, resp *http.Response, err error) {
+	span.SetAttribute("vili.role", t.String())
+	span.SetAttribute("server.port", port)
+	switch t {
+	case typelib.RUNNING:
+		span.SetAttribute("vili.version", serv.GetRunningVersion())
+	case typelib.TESTING:
+		span.SetAttribute("vili.version", serv.GetTestingVersion())
+	}
+	if err != nil {
+		span.SetError(err)
+	} else {
+		span.SetAttribute("http.response.status_code", resp.StatusCode)
+		if resp.StatusCode >= 500 {
+			span.SetError(fmt.Errorf("%s", resp.Status))
 		}
 	}
-	return resp, e
+	span.End()
+}
+
+func observation(route string, start time.Time, resp *http.Response) typelib.Observation {
+	o := typelib.Observation{
+		Route:   route,
+		Latency: time.Since(start),
+	}
+	if resp != nil {
+		o.Status = resp.StatusCode
+	}
+	return o
 }
 
 func verifyNewResponse(r, t *http.Response) error { // Take inn responses
@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector writes its metrics in the prometheus text format.
+type Collector interface {
+	Write(w io.Writer)
+}
+
+type Registry struct {
+	collectors []Collector
+	mutex      sync.Mutex
+}
+
+var Default = &Registry{}
+
+func Register(cs ...Collector) {
+	Default.Register(cs...)
+}
+
+func Handler() http.Handler {
+	return Default
+}
+
+func (r *Registry) Register(cs ...Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors = append(r.collectors, cs...)
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.mutex.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mutex.Unlock()
+	for _, c := range collectors {
+		c.Write(w)
+	}
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	var buf bytes.Buffer //Gauges are read under locks that should not wait for a slow scraper
+	r.Write(&buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, strings.ReplaceAll(d.help, "\n", " "), d.name, d.kind)
+}
+
+// series formats the labels of one series, extra is appended as is.
+func (d desc) series(name string, values []string, extra string) string {
+	var parts []string
+	for i, l := range d.labels {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, l, escape(v)))
+	}
+	if extra != "" {
+		parts = append(parts, extra)
+	}
+	if len(parts) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(v string) string {
+	return escaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+const separator = "\xff"
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type CounterVec struct {
+	desc
+	values map[string]float64
+	mutex  sync.Mutex
+}
+
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		values: make(map[string]float64),
+	}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, separator)
+	c.mutex.Lock()
+	c.values[key] += v
+	c.mutex.Unlock()
+}
+
+func (c *CounterVec) Write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.header(w)
+	if len(c.labels) == 0 && len(c.values) == 0 { //A counter without labels is always shown
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s %s\n", c.series(c.name, strings.Split(key, separator), ""), formatFloat(c.values[key]))
+	}
+}
+
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type HistogramVec struct {
+	desc
+	bounds []float64
+	values map[string]*histogram
+	mutex  sync.Mutex
+}
+
+func NewHistogram(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		desc:   desc{name: name, help: help, kind: "histogram", labels: labels},
+		bounds: bounds,
+		values: make(map[string]*histogram),
+	}
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, separator)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{buckets: make([]uint64, len(h.bounds))}
+		h.values[key] = hist
+	}
+	for i, bound := range h.bounds {
+		if v <= bound {
+			hist.buckets[i]++
+		}
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) Write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.header(w)
+	for _, key := range sortedKeys(h.values) {
+		values := strings.Split(key, separator)
+		hist := h.values[key]
+		for i, bound := range h.bounds {
+			fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", values, fmt.Sprintf(`le="%s"`, formatFloat(bound))), hist.buckets[i])
+		}
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", values, `le="+Inf"`), hist.count)
+		fmt.Fprintf(w, "%s %s\n", h.series(h.name+"_sum", values, ""), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_count", values, ""), hist.count)
+	}
+}
+
+// Gauge is read when scraped, collect calls emit once per series.
+type Gauge struct {
+	desc
+	collect func(emit func(v float64, labelValues ...string))
+}
+
+func NewGauge(name, help string, value func() float64) *Gauge {
+	return NewGaugeVec(name, help, nil, func(emit func(float64, ...string)) {
+		emit(value())
+	})
+}
+
+func NewGaugeVec(name, help string, labels []string, collect func(emit func(v float64, labelValues ...string))) *Gauge {
+	return &Gauge{
+		desc:    desc{name: name, help: help, kind: "gauge", labels: labels},
+		collect: collect,
+	}
+}
+
+func (g *Gauge) Write(w io.Writer) {
+	g.header(w)
+	g.collect(func(v float64, labelValues ...string) {
+		fmt.Fprintf(w, "%s %s\n", g.series(g.name, labelValues, ""), formatFloat(v))
+	})
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	requests := NewCounter("requests_total", "Requests.", "role", "status")
+	requests.Inc("running", "2xx")
+	requests.Add(2, "running", "2xx")
+	requests.Inc("test", "5xx")
+	deploys := NewCounter("deploys_total", "Deploys.")
+	latency := NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "role")
+	latency.Observe(0.05, "running")
+	latency.Observe(0.5, "running")
+	latency.Observe(5, "running")
+	ports := NewGauge("ports", "Ports.", func() float64 { return 4 })
+	quoted := NewGaugeVec("quoted", "Quoted.", []string{"v"}, func(emit func(float64, ...string)) {
+		emit(1, `a"b\c`)
+	})
+
+	r := &Registry{}
+	r.Register(requests, deploys, latency, ports, quoted)
+	var out strings.Builder
+	r.Write(&out)
+	for _, expected := range []string{
+		"# TYPE requests_total counter\n",
+		`requests_total{role="running",status="2xx"} 3` + "\n",
+		`requests_total{role="test",status="5xx"} 1` + "\n",
+		"deploys_total 0\n",
+		"# TYPE latency_seconds histogram\n",
+		`latency_seconds_bucket{role="running",le="0.1"} 1` + "\n",
+		`latency_seconds_bucket{role="running",le="1"} 2` + "\n",
+		`latency_seconds_bucket{role="running",le="+Inf"} 3` + "\n",
+		`latency_seconds_sum{role="running"} 5.55` + "\n",
+		`latency_seconds_count{role="running"} 3` + "\n",
+		"# TYPE ports gauge\nports 4\n",
+		`quoted{v="a\"b\\c"} 1` + "\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Missing %q in\n%s", expected, out.String())
+		}
+	}
+}
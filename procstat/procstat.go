@@ -0,0 +1,135 @@
+package procstat
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const clockTicks = 100 //USER_HZ is 100 on every linux we run on and can't be read without cgo
+
+type Sample struct {
+	Time    time.Time     `json:"time"`
+	RSS     int64         `json:"rss"`
+	CPU     time.Duration `json:"cpu"`
+	Threads int64         `json:"threads"`
+	FDs     int64         `json:"fds"`
+}
+
+func Read(pid int) (s Sample, err error) {
+	s.Time = time.Now()
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return
+	}
+	err = parseStat(string(stat), &s)
+	if err != nil {
+		return
+	}
+	fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return
+	}
+	s.FDs = int64(len(fds))
+	return
+}
+
+func parseStat(stat string, s *Sample) (err error) {
+	end := strings.LastIndex(stat, ")") //The command name can contain spaces and parentheses
+	if end < 0 {
+		return fmt.Errorf("Invalid stat format")
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return fmt.Errorf("Invalid stat format, only %d fields", len(fields))
+	}
+	values := make(map[int]int64)
+	for _, i := range []int{11, 12, 17, 21} { //utime, stime, num_threads and rss counted from the state field
+		values[i], err = strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return
+		}
+	}
+	s.CPU = time.Duration(values[11]+values[12]) * time.Second / clockTicks
+	s.Threads = values[17]
+	s.RSS = values[21] * int64(os.Getpagesize())
+	return
+}
+
+type Summary struct {
+	Samples       int     `json:"samples"`
+	MeanRSS       float64 `json:"mean_rss"`
+	RSSGrowth     float64 `json:"rss_growth"`
+	RSSGrowthFit  float64 `json:"rss_growth_fit"`
+	MeanCPU       float64 `json:"mean_cpu"`
+	MeanThreads   float64 `json:"mean_threads"`
+	MeanFDs       float64 `json:"mean_fds"`
+	DurationHours float64 `json:"duration_hours"`
+}
+
+// Summarize fits a line to RSS over time, RSSGrowth is the growth over the samples relative to the mean and
+// RSSGrowthFit is the R² of the fit, so steady growth has both a large growth and a fit close to 1.
+func Summarize(samples []Sample) (s Summary) {
+	s.Samples = len(samples)
+	if s.Samples == 0 {
+		return
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	var sumX, sumY, sumXY, sumXX, sumYY float64
+	for _, sample := range samples {
+		x := sample.Time.Sub(first.Time).Hours()
+		y := float64(sample.RSS)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+		sumYY += y * y
+		s.MeanThreads += float64(sample.Threads)
+		s.MeanFDs += float64(sample.FDs)
+	}
+	n := float64(s.Samples)
+	s.MeanRSS = sumY / n
+	s.MeanThreads /= n
+	s.MeanFDs /= n
+	s.DurationHours = last.Time.Sub(first.Time).Hours()
+	if s.DurationHours > 0 {
+		s.MeanCPU = (last.CPU - first.CPU).Hours() / s.DurationHours
+	}
+	varX := n*sumXX - sumX*sumX
+	varY := n*sumYY - sumY*sumY
+	if varX <= 0 || s.MeanRSS == 0 {
+		return
+	}
+	slope := (n*sumXY - sumX*sumY) / varX
+	s.RSSGrowth = slope * s.DurationHours / s.MeanRSS
+	if varY > 0 {
+		s.RSSGrowthFit = math.Pow(n*sumXY-sumX*sumY, 2) / (varX * varY)
+	}
+	return
+}
+
+func Mean(summaries []Summary) (s Summary) {
+	if len(summaries) == 0 {
+		return
+	}
+	for _, summary := range summaries {
+		s.Samples += summary.Samples
+		s.MeanRSS += summary.MeanRSS
+		s.MeanCPU += summary.MeanCPU
+		s.MeanThreads += summary.MeanThreads
+		s.MeanFDs += summary.MeanFDs
+		s.DurationHours = math.Max(s.DurationHours, summary.DurationHours)
+		if summary.RSSGrowth > s.RSSGrowth {
+			s.RSSGrowth, s.RSSGrowthFit = summary.RSSGrowth, summary.RSSGrowthFit
+		}
+	}
+	n := float64(len(summaries))
+	s.MeanRSS /= n
+	s.MeanCPU /= n
+	s.MeanThreads /= n
+	s.MeanFDs /= n
+	return
+}
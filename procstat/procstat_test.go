@@ -0,0 +1,55 @@
+package procstat
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseStat(t *testing.T) {
+	var s Sample
+	err := parseStat("7906 (java (main)) S 7902 7906 7902 0 -1 4194304 85 0 0 0 250 50 0 0 20 0 42 0 90387 2703360 1000 18446744073709551615 0", &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CPU != time.Second*3 {
+		t.Errorf("CPU %s != 3s", s.CPU)
+	}
+	if s.Threads != 42 {
+		t.Errorf("Threads %d != 42", s.Threads)
+	}
+	if s.RSS != 1000*int64(os.Getpagesize()) {
+		t.Errorf("RSS %d != 1000 pages", s.RSS)
+	}
+}
+
+func TestRead(t *testing.T) {
+	s, err := Read(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.RSS <= 0 || s.Threads <= 0 || s.FDs <= 0 {
+		t.Errorf("Unexpected sample of own process %+v", s)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Now()
+	var growing, flat []Sample
+	for i := 0; i < 60; i++ {
+		at := start.Add(time.Minute * time.Duration(i))
+		growing = append(growing, Sample{Time: at, RSS: 100_000_000 + int64(i)*1_000_000, CPU: time.Duration(i) * time.Second * 30})
+		flat = append(flat, Sample{Time: at, RSS: 100_000_000 + int64(i%2)*1_000_000})
+	}
+	g := Summarize(growing)
+	if g.RSSGrowth < 0.4 || g.RSSGrowthFit < 0.99 {
+		t.Errorf("Steady growth not detected %+v", g)
+	}
+	if g.MeanCPU < 0.49 || g.MeanCPU > 0.51 {
+		t.Errorf("Mean CPU %f != 0.5", g.MeanCPU)
+	}
+	f := Summarize(flat)
+	if f.RSSGrowth > 0.05 || f.RSSGrowthFit > 0.1 {
+		t.Errorf("Growth detected on flat memory %+v", f)
+	}
+}
@@ -0,0 +1,104 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	Version string          `json:"version"`
+	Reason  string          `json:"reason"`
+	Score   json.RawMessage `json:"score,omitempty"` //The score breakdown when the version was rejected by scoring
+	Time    time.Time       `json:"time"`
+}
+
+// Store keeps versions that should not be tested or started again, persisted as json so it survives restarts.
+type Store struct {
+	path    string
+	entries map[string]Entry
+	mutex   sync.Mutex
+}
+
+func Open(path string) (s *Store, err error) {
+	s = &Store{
+		path:    path,
+		entries: make(map[string]Entry),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return s, nil
+		}
+		return
+	}
+	var entries []Entry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		s.entries[e.Version] = e
+	}
+	return
+}
+
+func (s *Store) Add(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[e.Version] = e
+	return s.save()
+}
+
+func (s *Store) Remove(version string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.entries[version]; !ok {
+		return false, nil
+	}
+	delete(s.entries, version)
+	return true, s.save()
+}
+
+func (s *Store) Contains(version string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.entries[version]
+	return ok
+}
+
+func (s *Store) List() []Entry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.list()
+}
+
+func (s *Store) list() (entries []Entry) {
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path) //So a crash never leaves a half written file
+}
@@ -0,0 +1,46 @@
+package quarantine
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Contains("app-1.0.0") {
+		t.Error("Empty store contains version")
+	}
+	err = s.Add(Entry{Version: "app-1.0.0", Reason: "rejected", Score: []byte(`{"verdict":"REJECT"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Add(Entry{Version: "app-1.0.1", Reason: "broken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := s.List()
+	if len(entries) != 2 || entries[0].Version != "app-1.0.0" || entries[0].Reason != "rejected" || !strings.Contains(string(entries[0].Score), `"REJECT"`) {
+		t.Errorf("Store was not persisted, got %v", entries)
+	}
+	removed, err := s.Remove("app-1.0.0")
+	if err != nil || !removed {
+		t.Fatalf("Remove = %v, %v", removed, err)
+	}
+	removed, err = s.Remove("app-1.0.0")
+	if err != nil || removed {
+		t.Errorf("Removing twice = %v, %v", removed, err)
+	}
+	if s.Contains("app-1.0.0") || !s.Contains("app-1.0.1") {
+		t.Errorf("Wrong versions after remove, got %v", s.List())
+	}
+}
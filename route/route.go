@@ -0,0 +1,82 @@
+package route
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/cantara/vili/envlib"
+)
+
+const Id = "{id}"
+
+var (
+	numberRegex = regexp.MustCompile(`^\d+$`)
+	uuidRegex   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexRegex    = regexp.MustCompile(`^[0-9a-fA-F]{12,}$`)
+	tokenRegex  = regexp.MustCompile(`^[\w-]{20,}$`)
+	digitRegex  = regexp.MustCompile(`\d`)
+)
+
+type Templates struct {
+	templates [][]string
+}
+
+func TemplatesFromEnv() Templates {
+	return NewTemplates(envlib.List("route_templates"))
+}
+
+func NewTemplates(templates []string) (t Templates) {
+	for _, template := range templates {
+		t.templates = append(t.templates, split(template))
+	}
+	return
+}
+
+// Route groups a request into a route template, configured templates are tried first and otherwise segments that look like ids are collapsed.
+func (t Templates) Route(method, path string) string {
+	segments := split(path)
+	for _, template := range t.templates {
+		if matches(template, segments) {
+			return method + " /" + strings.Join(template, "/")
+		}
+	}
+	for i, segment := range segments {
+		if isId(segment) {
+			segments[i] = Id
+		}
+	}
+	return method + " /" + strings.Join(segments, "/")
+}
+
+func split(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func matches(template, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i := range template {
+		if strings.HasPrefix(template[i], "{") && strings.HasSuffix(template[i], "}") {
+			continue
+		}
+		if template[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isId(segment string) bool {
+	if numberRegex.MatchString(segment) || uuidRegex.MatchString(segment) {
+		return true
+	}
+	if hexRegex.MatchString(segment) && digitRegex.MatchString(segment) {
+		return true
+	}
+	return tokenRegex.MatchString(segment) && digitRegex.MatchString(segment)
+}
@@ -0,0 +1,30 @@
+package route
+
+import "testing"
+
+func TestRoute(t *testing.T) {
+	templates := NewTemplates([]string{"/users/{id}", "/orders/{order}/items/{item}", "/files/{name}"})
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/", "GET /"},
+		{"GET", "/health", "GET /health"},
+		{"GET", "/users/bob", "GET /users/{id}"},
+		{"PUT", "/users/42/", "PUT /users/{id}"},
+		{"GET", "/orders/17/items/3", "GET /orders/{order}/items/{item}"},
+		{"GET", "/files/report.pdf", "GET /files/{name}"},
+		{"GET", "/accounts/123/settings", "GET /accounts/{id}/settings"},
+		{"GET", "/accounts/0f8fad5b-d9cb-469f-a165-70867728950e", "GET /accounts/{id}"},
+		{"GET", "/blobs/5e884898da28047151d0e56f8dc6292773603d0d", "GET /blobs/{id}"},
+		{"GET", "/tokens/eyJhbGciOiJIUzI1NiIsInR5cCI6", "GET /tokens/{id}"},
+		{"GET", "/api/v2/status", "GET /api/v2/status"},
+		{"GET", "/feed/deadbeefcafe", "GET /feed/deadbeefcafe"},
+	}
+	for _, test := range tests {
+		if route := templates.Route(test.method, test.path); route != test.expected {
+			t.Errorf("Route(%s, %s) = %s, expected %s", test.method, test.path, route, test.expected)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cantara/vili/envlib"
+)
+
+const (
+	dateLayout   = "2006-01-02"
+	maxLookAhead = time.Hour * 24 * 400
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type Window struct {
+	days       [7]bool
+	start, end int //Minutes after midnight, a window ending before it starts runs past midnight
+}
+
+type Blackout struct {
+	from, to string //Dates are compared as strings in the schedules timezone
+}
+
+type Schedule struct {
+	Windows   []Window
+	Blackouts []Blackout
+	Location  *time.Location
+}
+
+// FromEnv reads deploy_windows as windows separated by ; like "mon-fri 09:00-15:00; sat 10:00-12:00",
+// deploy_blackouts as dates or date ranges like "2026-12-24, 2026-12-30..2027-01-02" and deploy_timezone.
+func FromEnv() (s Schedule, err error) {
+	s.Location = time.Local
+	if tz := os.Getenv("deploy_timezone"); tz != "" {
+		s.Location, err = time.LoadLocation(tz)
+		if err != nil {
+			return
+		}
+	}
+	for _, w := range strings.Split(os.Getenv("deploy_windows"), ";") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		var window Window
+		window, err = ParseWindow(w)
+		if err != nil {
+			return
+		}
+		s.Windows = append(s.Windows, window)
+	}
+	for _, b := range envlib.List("deploy_blackouts") {
+		var blackout Blackout
+		blackout, err = ParseBlackout(b)
+		if err != nil {
+			return
+		}
+		s.Blackouts = append(s.Blackouts, blackout)
+	}
+	return
+}
+
+func ParseWindow(s string) (w Window, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		err = fmt.Errorf("Invalid deploy window %q, expected days and time range like \"mon-fri 09:00-15:00\"", s)
+		return
+	}
+	w.days, err = parseDays(fields[0])
+	if err != nil {
+		return
+	}
+	start, end, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		err = fmt.Errorf("Invalid time range %q in deploy window", fields[1])
+		return
+	}
+	w.start, err = parseClock(start)
+	if err != nil {
+		return
+	}
+	w.end, err = parseClock(end)
+	return
+}
+
+func parseDays(s string) (days [7]bool, err error) {
+	if s == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return
+	}
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			err = fmt.Errorf("Invalid weekday %q", from)
+			return
+		}
+		last := first
+		if isRange {
+			last, ok = weekdays[to]
+			if !ok {
+				err = fmt.Errorf("Invalid weekday %q", to)
+				return
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return
+}
+
+func parseClock(s string) (minutes int, err error) {
+	hour, minute, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("Invalid time %q, expected HH:MM", s)
+	}
+	h, err := strconv.Atoi(hour)
+	if err != nil {
+		return
+	}
+	m, err := strconv.Atoi(minute)
+	if err != nil {
+		return
+	}
+	minutes = h*60 + m
+	if h < 0 || m < 0 || m > 59 || minutes > 24*60 {
+		return 0, fmt.Errorf("Invalid time %q", s)
+	}
+	return
+}
+
+func ParseBlackout(s string) (b Blackout, err error) {
+	from, to, isRange := strings.Cut(s, "..")
+	if !isRange {
+		to = from
+	}
+	for _, date := range []string{from, to} {
+		if _, err = time.Parse(dateLayout, date); err != nil {
+			return
+		}
+	}
+	return Blackout{from: from, to: to}, nil
+}
+
+func (w Window) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+	return (w.days[day] && minute >= w.start) || (w.days[(day+6)%7] && minute < w.end)
+}
+
+func (b Blackout) contains(t time.Time) bool {
+	date := t.Format(dateLayout)
+	return date >= b.from && date <= b.to
+}
+
+// Allowed is true when t is inside a window and outside every blackout, no windows means any time is allowed.
+func (s Schedule) Allowed(t time.Time) bool {
+	if s.Location != nil {
+		t = t.In(s.Location)
+	}
+	for _, b := range s.Blackouts {
+		if b.contains(t) {
+			return false
+		}
+	}
+	if len(s.Windows) == 0 {
+		return true
+	}
+	for _, w := range s.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the first allowed minute from t, or the zero time if nothing is allowed within a year.
+func (s Schedule) Next(t time.Time) time.Time {
+	if s.Allowed(t) {
+		return t
+	}
+	for next := t.Truncate(time.Minute).Add(time.Minute); next.Sub(t) < maxLookAhead; next = next.Add(time.Minute) {
+		if s.Allowed(next) {
+			return next
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowed(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skip("No timezone data: ", err)
+	}
+	var s Schedule
+	for _, w := range []string{"mon-fri 09:00-15:00", "sat 22:00-02:00"} {
+		window, err := ParseWindow(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Windows = append(s.Windows, window)
+	}
+	blackout, err := ParseBlackout("2026-12-21..2026-12-23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Blackouts = append(s.Blackouts, blackout)
+	s.Location = oslo
+	tests := []struct {
+		time    string
+		allowed bool
+	}{
+		{"2026-10-19T10:00:00+02:00", true},  //Monday
+		{"2026-10-19T08:00:00Z", true},       //Monday 10:00 in Oslo
+		{"2026-10-19T15:00:00+02:00", false}, //Window end is exclusive
+		{"2026-10-19T03:00:00+02:00", false}, //Night
+		{"2026-10-24T23:00:00+02:00", true},  //Saturday night
+		{"2026-10-25T01:30:00+02:00", true},  //Runs past midnight into sunday
+		{"2026-10-25T12:00:00+01:00", false}, //Sunday
+		{"2026-12-22T10:00:00+01:00", false}, //Blackout
+		{"2026-12-24T10:00:00+01:00", true},  //After blackout
+	}
+	for _, test := range tests {
+		at, err := time.Parse(time.RFC3339, test.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed := s.Allowed(at); allowed != test.allowed {
+			t.Errorf("Allowed(%s) = %v, expected %v", test.time, allowed, test.allowed)
+		}
+	}
+	at, _ := time.Parse(time.RFC3339, "2026-10-19T16:20:00+02:00")
+	if next := s.Next(at); !next.Equal(time.Date(2026, 10, 20, 9, 0, 0, 0, oslo)) {
+		t.Errorf("Next(%s) = %s", at, next)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, w := range []string{"mon 09:00", "funday 09:00-10:00", "mon 25:00-26:00", "mon 09-10"} {
+		if _, err := ParseWindow(w); err == nil {
+			t.Errorf("ParseWindow(%q) should fail", w)
+		}
+	}
+	if _, err := ParseBlackout("2026-13-01"); err == nil {
+		t.Error("ParseBlackout should fail on invalid date")
+	}
+}
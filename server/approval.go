@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/slack"
+)
+
+var ErrNoTesting = fmt.Errorf("No testing version")
+
+func (s *server) awaitApproval(result scorer.Result) {
+	s.testing.mutex.Lock()
+	if s.awaitingApproval || s.testing.isDying || len(s.testing.replicas) == 0 {
+		s.testing.mutex.Unlock()
+		return
+	}
+	s.awaitingApproval = true
+	version := s.testing.dir.File().Name()
+	s.testing.mutex.Unlock()
+	log.Info("Testing version ", version, " passed and awaits approval")
+	go slack.Sendf(" :raised_hand: Vili testing version %s on host: %s passed and awaits approval to replace %s, %s with %s. Approve with `vili approve` or reject with `vili reject`.",
+		version, s.hostname, s.GetRunningVersion(), result, fingerprintSummary(s.NewFingerprints()))
+}
+
+func (s *server) AwaitingApproval() bool {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	return s.awaitingApproval
+}
+
+// Approve promotes testing, it still waits for the next deploy window when outside of one.
+func (s *server) Approve() error {
+	if s.Frozen() {
+		return ErrFrozen
+	}
+	s.testing.mutex.Lock()
+	if s.testing.isDying || len(s.testing.replicas) == 0 {
+		s.testing.mutex.Unlock()
+		return ErrNoTesting
+	}
+	s.awaitingApproval = false
+	version := s.testing.dir.File().Name()
+	s.testing.mutex.Unlock()
+	log.Info("Testing version ", version, " approved")
+	go slack.Sendf(" :ok_hand: Vili testing version %s on host: %s was approved.", version, s.hostname)
+	_, err := s.Deploy(true) //Waiting for the window is announced by itself
+	return err
+}
+
+// Reject abandons testing, which quarantines it so it is not started again.
+func (s *server) Reject(reason string) error {
+	s.testing.mutex.Lock()
+	if s.testing.isDying || len(s.testing.replicas) == 0 {
+		s.testing.mutex.Unlock()
+		return ErrNoTesting
+	}
+	s.testing.mutex.Unlock()
+	return s.AbandonTesting(fmt.Sprintf("rejected by hand, %s", reason))
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/slack"
+)
+
+func (s *server) recordWindow(result scorer.Result, err error, note string) {
+	summary := result.String()
+	if err != nil {
+		summary = "not scored, " + err.Error()
+	}
+	if note != "" {
+		summary = note + ", " + summary
+	}
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	s.windows = append(s.windows, summary)
+}
+
+// concludeTesting rejects testing that has had all its test windows or test time without a verdict.
+// The last score, if there is one, is kept with the quarantined version.
+func (s *server) concludeTesting(hostname string, result scorer.Result, scoreErr error) bool {
+	s.testing.mutex.Lock()
+	windows := append([]string(nil), s.windows...)
+	started := s.testStarted
+	s.testing.mutex.Unlock()
+	tested := time.Since(started)
+	var reason string
+	switch {
+	case s.maxTestWindows > 0 && len(windows) >= s.maxTestWindows:
+		reason = fmt.Sprintf("no verdict after %d test windows", len(windows))
+	case s.maxTestTime > 0 && !started.IsZero() && tested >= s.maxTestTime:
+		reason = fmt.Sprintf("no verdict after testing for %s", tested.Round(time.Minute))
+	default:
+		return false
+	}
+	if !s.claimTesting() {
+		return true
+	}
+	var summary strings.Builder
+	for i, w := range windows {
+		fmt.Fprintf(&summary, "\n%d. %s", i+1, w)
+	}
+	version := s.GetTestingVersion()
+	var last *scorer.Result
+	if scoreErr == nil {
+		last = &result
+	}
+	err := s.abandon(reason, last)
+	if errors.Is(err, ErrFrozen) { //Announced when the verdict is held
+		return true
+	}
+	if err != nil {
+		log.AddError(err).Error("While rejecting inconclusive testing")
+		return true
+	}
+	log.Warning("Rejected testing version ", version, ", ", reason, summary.String())
+	go slack.Sendf(" :hourglass: :x: Vili gave up on testing version %s on host: %s, %s.%s", version, hostname, reason, summary.String())
+	return true
+}
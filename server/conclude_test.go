@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/typelib"
+)
+
+func TestConcludeTesting(t *testing.T) {
+	last := scorer.Result{Verdict: scorer.KEEP, Score: -70, Summary: "running 100 points, testing 30 points"}
+	tests := []struct {
+		name       string
+		maxWindows int
+		maxTime    time.Duration
+		windows    int
+		tested     time.Duration
+		scoreErr   error
+		concluded  bool
+		withScore  bool
+	}{
+		{"windows left", 3, 0, 2, time.Hour, nil, false, false},
+		{"all windows used", 3, 0, 3, time.Hour, nil, true, true},
+		{"windows unlimited", 0, 0, 20, time.Hour * 5, nil, false, false},
+		{"time left", 0, time.Hour * 2, 4, time.Hour, nil, false, false},
+		{"out of time", 0, time.Hour * 2, 8, time.Hour*2 + time.Minute, nil, true, true},
+		{"out of time without score", 0, time.Hour, 4, time.Hour * 2, fmt.Errorf("Testduration does not exceed minimum test time"), true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, archived := newTestServer(t)
+			s.maxTestWindows = test.maxWindows
+			s.maxTestTime = test.maxTime
+			dir := versionDir(t, s, "app-1.0.1")
+			_, f := addReplica(s, typelib.TESTING, dir)
+			s.testStarted = time.Now().Add(-test.tested)
+			for i := 0; i < test.windows; i++ {
+				s.recordWindow(last, nil, "")
+			}
+
+			if concluded := s.concludeTesting("test", last, test.scoreErr); concluded != test.concluded {
+				t.Fatalf("Concluded %v, expected %v", concluded, test.concluded)
+			}
+			if !test.concluded {
+				if !s.HasTesting() || s.Quarantined("app-1.0.1") {
+					t.Error("Testing was rejected before it had used its windows and time")
+				}
+				expectNotArchived(t, archived)
+				return
+			}
+			if s.HasTesting() || f.IsRunning() {
+				t.Error("Testing was not stopped")
+			}
+			expectArchived(t, archived, "app-1.0.1")
+			entries := s.QuarantineList()
+			if len(entries) != 1 || entries[0].Version != "app-1.0.1" {
+				t.Fatalf("Quarantine = %v", entries)
+			}
+			var score scorer.Result
+			err := json.Unmarshal(entries[0].Score, &score)
+			if test.withScore && (err != nil || score.Score != last.Score) {
+				t.Errorf("Quarantine entry lost the score breakdown, %s, %v", entries[0].Score, err)
+			}
+			if !test.withScore && len(entries[0].Score) > 0 {
+				t.Errorf("Quarantine entry has a score without being scored, %s", entries[0].Score)
+			}
+		})
+	}
+}
+
+func TestExtendedWindowsCount(t *testing.T) {
+	s, archived := newTestServer(t)
+	s.maxTestWindows = 2
+	s.minShadowRequests = 1000 //Testing never gets enough traffic
+	dir := versionDir(t, s, "app-1.0.1")
+	addReplica(s, typelib.TESTING, dir)
+	s.testStarted = time.Now()
+
+	s.testing.mesureFrom = time.Now().Add(-s.testWindow - time.Minute)
+	s.CheckReliability("test")
+	s.CheckReliability("test") //The same window is only counted once
+	if len(s.windows) != 1 || !s.HasTesting() {
+		t.Fatalf("Expected one extended window, got %v", s.windows)
+	}
+	mesureFrom := s.testing.mesureFrom
+
+	s.windowEnded = time.Now().Add(-s.testWindow - time.Minute)
+	s.CheckReliability("test")
+	if s.HasTesting() {
+		t.Fatal("Testing that never got enough traffic was not rejected after its windows")
+	}
+	if !mesureFrom.Equal(s.testing.mesureFrom) {
+		t.Error("Extending a window reset the counters")
+	}
+	expectArchived(t, archived, "app-1.0.1")
+	if !s.Quarantined("app-1.0.1") {
+		t.Error("Rejected testing was not quarantined")
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cantara/vili/slack"
+	"github.com/cantara/vili/typelib"
+)
+
+// missingCoverage lists what testing still lacks before it can be promoted.
+func (s *server) missingCoverage() (missing []string) {
+	testing := s.testing.counters()
+	if testing.Requests < s.minShadowRequests {
+		missing = append(missing, fmt.Sprintf("%d of %d requests", testing.Requests, s.minShadowRequests))
+	}
+	testingRoutes := s.testing.routes()
+	runningRoutes := s.running.routes()
+	minRoutes := s.minRoutes
+	if len(runningRoutes) < minRoutes { //Can't ask for more routes than the service has traffic on
+		minRoutes = len(runningRoutes)
+	}
+	if len(testingRoutes) < minRoutes {
+		missing = append(missing, fmt.Sprintf("%d of %d routes", len(testingRoutes), minRoutes))
+	}
+	if s.minMethodRequests <= 0 {
+		return
+	}
+	testingMethods := methodRequests(testingRoutes)
+	for method := range methodRequests(runningRoutes) {
+		if testingMethods[method] < s.minMethodRequests {
+			missing = append(missing, fmt.Sprintf("%d of %d %s requests", testingMethods[method], s.minMethodRequests, method))
+		}
+	}
+	return
+}
+
+func methodRequests(routes map[string]typelib.RouteCounters) map[string]int64 {
+	methods := make(map[string]int64)
+	for route, c := range routes {
+		method, _, _ := strings.Cut(route, " ")
+		methods[method] += c.Requests
+	}
+	return methods
+}
+
+// claimStuckReport is true once every test window while testing is waiting for traffic.
+func (s *server) claimStuckReport() (waited time.Duration, ok bool) {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	waited = time.Since(s.testing.mesureFrom)
+	if len(s.testing.replicas) == 0 || waited < s.testWindow || time.Since(s.stuckReported) < s.testWindow {
+		return
+	}
+	s.stuckReported = time.Now()
+	return waited, true
+}
+
+func (s *server) reportStuck(hostname string, missing []string) {
+	waited, ok := s.claimStuckReport()
+	if !ok {
+		return
+	}
+	go slack.Sendf(" :turtle: Vili testing version %s on host: %s has not had enough traffic after %s, missing %s.",
+		s.GetTestingVersion(), hostname, waited.Round(time.Minute), strings.Join(missing, ", "))
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"time"
+
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/typelib"
+)
+
+func (s *server) Events(f eventlog.Filter) ([]eventlog.Event, error) {
+	return s.events.Query(f)
+}
+
+func (s *server) servletEvent(t eventlog.Type, r *replica, message string) {
+	s.events.Add(eventlog.Event{
+		Type:    t,
+		Version: r.version,
+		Role:    r.serverType.String(),
+		Port:    r.Port(),
+		Message: message,
+		Data:    map[string]interface{}{"pid": r.Pid()},
+	})
+}
+
+// watchLifecycle records when a replica gets ready and when it stops without being retired.
+func (s *server) watchLifecycle(r *replica) {
+	select {
+	case <-r.Ready():
+		s.events.Add(eventlog.Event{
+			Type:    eventlog.SERVLET_READY,
+			Version: r.version,
+			Role:    r.serverType.String(),
+			Port:    r.Port(),
+			Data:    map[string]interface{}{"startup_seconds": r.StartupTime().Seconds()},
+		})
+	case <-r.Exited():
+	}
+	<-r.Exited()
+	if r.isRetired() {
+		return
+	}
+	s.servletEvent(eventlog.SERVLET_CRASHED, r, "stopped after "+time.Since(r.Started()).Round(time.Second).String())
+}
+
+func (s *server) testResetEvent(message string, score *float64) {
+	e := eventlog.Event{
+		Type:    eventlog.TEST_RESET,
+		Version: s.GetTestingVersion(),
+		Role:    typelib.TESTING.String(),
+		Message: message,
+	}
+	if score != nil {
+		e.Data = map[string]interface{}{"score": finiteScore(*score)}
+	}
+	s.events.Add(e)
+}
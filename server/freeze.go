@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/slack"
+	"github.com/cantara/vili/typelib"
+)
+
+const (
+	freezeFile          = "FREEZE"
+	freezeCheckInterval = time.Second * 5
+)
+
+var ErrFrozen = fmt.Errorf("Vili is frozen")
+
+// Frozen is true while frozen by hand or while there is a FREEZE file in the base folder.
+func (s *server) Frozen() bool {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	return s.frozen || s.frozenByFile
+}
+
+func (s *server) freezeFileExists() bool {
+	_, err := os.Stat(filepath.Join(s.dir.Path(), freezeFile))
+	return err == nil
+}
+
+func (s *server) Freeze() error {
+	return s.command(commandData{command: freezeServer})
+}
+
+func (s *server) Unfreeze() error {
+	return s.command(commandData{command: unfreezeServer})
+}
+
+func (s *server) HeldVersion() string {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	if s.held == nil {
+		return ""
+	}
+	return s.held.File().Name()
+}
+
+// watchFreeze notices the FREEZE file being added or removed, so Frozen does not have to look for it.
+func (s *server) watchFreeze(ctx context.Context) {
+	ticker := time.NewTicker(freezeCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.updateFreeze()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// updateFreeze announces changes of the freeze and starts the version held back while frozen.
+func (s *server) updateFreeze() {
+	byFile := s.freezeFileExists()
+	s.testing.mutex.Lock()
+	s.frozenByFile = byFile
+	frozen := s.frozen || byFile
+	changed := frozen != s.wasFrozen
+	s.wasFrozen = frozen
+	s.testing.mutex.Unlock()
+	if !changed {
+		return
+	}
+	if frozen {
+		cause := "by hand"
+		if byFile {
+			cause = "by the " + freezeFile + " file"
+		}
+		log.Warning("Vili is frozen ", cause)
+		s.events.Add(eventlog.Event{Type: eventlog.FROZEN, Message: cause})
+		go slack.Sendf(" :ice_cube: Vili is frozen %s on host: %s, running version %s. New versions are not started and nothing is promoted or rolled back until it is unfrozen.", cause, s.hostname, s.GetRunningVersion())
+		return
+	}
+	log.Info("Vili is unfrozen")
+	held := s.HeldVersion()
+	verdict := s.takeHeldVerdict()
+	s.events.Add(eventlog.Event{Type: eventlog.UNFROZEN, Version: held})
+	if held == "" {
+		go slack.Sendf(" :sunny: Vili is unfrozen on host: %s, running version %s.", s.hostname, s.GetRunningVersion())
+	} else {
+		go slack.Sendf(" :sunny: Vili is unfrozen on host: %s, running version %s, starting to test held version %s.", s.hostname, s.GetRunningVersion(), held)
+	}
+	if verdict == nil && held == "" {
+		return
+	}
+	go func() { //Commands can't be sent from the command watcher, which updates the freeze when unfrozen by hand
+		if verdict != nil {
+			err := s.command(*verdict)
+			if err != nil {
+				log.AddError(err).Error("While abandoning testing after the freeze")
+			}
+		}
+		if held == "" {
+			return
+		}
+		err := s.command(commandData{command: startHeld})
+		if err != nil {
+			log.AddError(err).Error("While starting held version ", held)
+		}
+	}()
+}
+
+// holdVerdict keeps an abandon of testing decided by vili until it is unfrozen, it is run from the command watcher.
+func (s *server) holdVerdict(command commandData) {
+	s.testing.mutex.Lock()
+	if len(s.testing.replicas) == 0 || s.heldVerdict != nil || (command.replica != nil && !s.testing.contains(command.replica)) {
+		s.testing.mutex.Unlock()
+		return
+	}
+	command.replica = nil
+	command.errorChan = nil
+	s.heldVerdict = &command
+	s.heldVerdictDir = s.testing.dir
+	version := s.testing.dir.File().Name()
+	s.testing.mutex.Unlock()
+	log.Warning("Not abandoning testing version ", version, " while frozen: ", command.reason)
+	go slack.Sendf(" :ice_cube: :x: Vili testing version %s on host: %s failed but is kept while vili is frozen, it is abandoned when vili is unfrozen. Reason: %s.", version, s.hostname, command.reason)
+}
+
+// takeHeldVerdict gives the abandon held while frozen, if testing is still the version it was decided for.
+func (s *server) takeHeldVerdict() *commandData {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	verdict := s.heldVerdict
+	s.heldVerdict = nil
+	if verdict == nil || len(s.testing.replicas) == 0 || !samePath(s.heldVerdictDir, s.testing.dir) {
+		return nil
+	}
+	return verdict
+}
+
+// hold keeps a new version from starting while frozen, only the newest is kept. It is run from the command watcher.
+func (s *server) hold(serverDir fslib.Dir) {
+	s.testing.mutex.Lock()
+	old := s.held
+	s.held = serverDir
+	s.testing.mutex.Unlock()
+	if old != nil && old.Path() != serverDir.Path() {
+		s.archive(old)
+	}
+	log.Info("Holding ", serverDir.File().Name(), " while frozen")
+	go slack.Sendf(" :ice_cube: :mailbox_with_mail: Vili found version %s on host: %s, it is not tested while vili is frozen. Running version is %s.", serverDir.File().Name(), s.hostname, s.GetRunningVersion())
+}
+
+// startHeld starts testing the version held while frozen, it is run from the command watcher.
+func (s *server) startHeld() error {
+	if s.Frozen() {
+		return ErrFrozen
+	}
+	s.testing.mutex.Lock()
+	serverDir := s.held
+	s.held = nil
+	s.testing.mutex.Unlock()
+	if serverDir == nil {
+		return nil
+	}
+	if s.Quarantined(serverDir.File().Name()) {
+		return ErrQuarantined
+	}
+	s.replaceTesting()
+	return s.startServiceFromWatcher(serverDir, typelib.TESTING, nil)
+}
+
+// reportFrozenPass tells once per version that testing passed but is not promoted while frozen.
+func (s *server) reportFrozenPass(result scorer.Result) {
+	s.testing.mutex.Lock()
+	if s.testing.dir == nil || s.frozenPassed == s.testing.dir.Path() {
+		s.testing.mutex.Unlock()
+		return
+	}
+	s.frozenPassed = s.testing.dir.Path()
+	version := s.testing.dir.File().Name()
+	s.testing.mutex.Unlock()
+	log.Info("Testing version ", version, " passed while frozen")
+	go slack.Sendf(" :ice_cube: Vili testing version %s on host: %s passed but is not promoted while vili is frozen, %s.", version, s.hostname, result)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/typelib"
+)
+
+func TestFreezeHoldsAbandon(t *testing.T) {
+	s, archived := newTestServer(t)
+	dir := versionDir(t, s, "app-1.0.1")
+	addReplica(s, typelib.TESTING, dir)
+	if err := s.Freeze(); err != nil || !s.Frozen() {
+		t.Fatalf("Freeze failed, %v", err)
+	}
+
+	result := scorer.Result{Verdict: scorer.REJECT, Score: -0.2}
+	if err := s.abandonWithResult(result); !errors.Is(err, ErrFrozen) {
+		t.Errorf("Abandon while frozen gave %v, expected %v", err, ErrFrozen)
+	}
+	if !s.HasTesting() || s.Quarantined("app-1.0.1") {
+		t.Fatal("Testing was abandoned while frozen")
+	}
+	expectNotArchived(t, archived)
+
+	if err := s.Unfreeze(); err != nil {
+		t.Fatal(err)
+	}
+	expectArchived(t, archived, "app-1.0.1")
+	deadline := time.Now().Add(time.Second * 5)
+	for s.HasTesting() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if s.HasTesting() || !s.Quarantined("app-1.0.1") {
+		t.Error("The verdict held while frozen was not carried out when unfrozen")
+	}
+}
+
+func TestFreezeFile(t *testing.T) {
+	s, _ := newTestServer(t)
+	f, err := s.dir.Create(freezeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if s.Frozen() {
+		t.Error("The FREEZE file should be read by watchFreeze, not on every check")
+	}
+	s.updateFreeze()
+	if !s.Frozen() {
+		t.Error("FREEZE file did not freeze vili")
+	}
+	if err := s.Unfreeze(); err == nil {
+		t.Error("Unfreezing with a FREEZE file should fail")
+	}
+	s.dir.Remove(freezeFile)
+	s.updateFreeze()
+	if s.Frozen() {
+		t.Error("Removing the FREEZE file did not unfreeze vili")
+	}
+}
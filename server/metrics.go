@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cantara/vili/metrics"
+	"github.com/cantara/vili/typelib"
+)
+
+var (
+	requestsTotal   = metrics.NewCounter("vili_requests_total", "Requests proxied or shadowed to servlets by role and status class.", "role", "status")
+	requestDuration = metrics.NewHistogram("vili_request_duration_seconds", "Latency of requests to servlets by role.", metrics.DefaultBuckets, "role")
+	restartsTotal   = metrics.NewCounter("vili_restarts_total", "Servlet restarts by role.", "role")
+	deploysTotal    = metrics.NewCounter("vili_deploys_total", "Testing versions promoted to running.")
+	rollbacksTotal  = metrics.NewCounter("vili_rollbacks_total", "Promotions rolled back to the previous version.")
+	abandonedTotal  = metrics.NewCounter("vili_abandoned_total", "Testing versions abandoned.")
+)
+
+func init() {
+	metrics.Register(requestsTotal, requestDuration, restartsTotal, deploysTotal, rollbacksTotal, abandonedTotal)
+}
+
+func observeRequest(t typelib.ServerType, o typelib.Observation, err error) {
+	status := "error"
+	if err == nil {
+		status = fmt.Sprintf("%dxx", typelib.StatusClass(o.Status))
+	}
+	requestsTotal.Inc(t.String(), status)
+	requestDuration.Observe(o.Latency.Seconds(), t.String())
+}
+
+// registerMetrics adds what is read from the server when scraped.
+func (s *server) registerMetrics() {
+	roles := []*servletHandler{&s.running, &s.testing, &s.previous}
+	metrics.Register(
+		metrics.NewGaugeVec("vili_replicas", "Replicas by role.", []string{"role"}, func(emit func(float64, ...string)) {
+			for _, h := range roles {
+				h.mutex.Lock()
+				n := len(h.replicas)
+				h.mutex.Unlock()
+				emit(float64(n), h.serverType.String())
+			}
+		}),
+		windowGauge("vili_window_requests", "Requests since the current test window started by role.", roles, func(c typelib.Counters) int64 { return c.Requests }),
+		windowGauge("vili_window_breaking", "Breaking responses since the current test window started by role.", roles, func(c typelib.Counters) int64 { return c.Breaking }),
+		windowGauge("vili_window_errors", "Logged errors since the current test window started by role.", roles, func(c typelib.Counters) int64 { return c.Errors }),
+		windowGauge("vili_window_warnings", "Logged warnings since the current test window started by role.", roles, func(c typelib.Counters) int64 { return c.Warnings }),
+		metrics.NewGaugeVec("vili_reliability_score", "Reliability score of testing compared to running, missing without a score.", nil, func(emit func(float64, ...string)) {
+			if !s.HasTesting() {
+				return
+			}
+			if result, err := s.ReliabilityScore(); err == nil {
+				emit(result.Score)
+			}
+		}),
+		metrics.NewGauge("vili_testing_seconds", "How long the testing version has been tested.", func() float64 {
+			return s.TestingDuration().Seconds()
+		}),
+		metrics.NewGauge("vili_available_ports", "Ports left in the port range.", func() float64 {
+			return float64(s.availablePortCount())
+		}),
+		metrics.NewGauge("vili_promotion_paused", "1 while automatic promotion is paused.", func() float64 {
+			return boolGauge(s.promotionPaused())
+		}),
+		metrics.NewGauge("vili_frozen", "1 while vili is frozen.", func() float64 {
+			return boolGauge(s.Frozen())
+		}),
+		metrics.NewGauge("vili_uptime_seconds", "How long vili has run.", func() float64 {
+			return time.Since(s.started).Seconds()
+		}),
+	)
+}
+
+func windowGauge(name, help string, roles []*servletHandler, value func(typelib.Counters) int64) *metrics.Gauge {
+	return metrics.NewGaugeVec(name, help, []string{"role"}, func(emit func(float64, ...string)) {
+		for _, h := range roles {
+			emit(float64(value(h.counters())), h.serverType.String())
+		}
+	})
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
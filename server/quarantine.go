@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/quarantine"
+	"github.com/cantara/vili/server/scorer"
+)
+
+var ErrQuarantined = fmt.Errorf("Version is quarantined")
+
+func stripJar(server string) string {
+	return strings.TrimSuffix(filepath.Base(server), ".jar")
+}
+
+func (s *server) quarantineVersion(serverDir fslib.Dir, reason string, result *scorer.Result) {
+	e := quarantine.Entry{
+		Version: serverDir.File().Name(),
+		Reason:  reason,
+	}
+	if result != nil {
+		score, err := json.Marshal(result)
+		if err == nil {
+			e.Score = score
+		}
+	}
+	err := s.quarantine.Add(e)
+	if err != nil {
+		log.AddError(err).Error("While quarantining ", e.Version)
+	}
+}
+
+func (s *server) abandonWithResult(result scorer.Result) error {
+	return s.abandon(result.String(), &result)
+}
+
+// abandon quarantines testing with the score that made it fail, result can be nil. It is held while frozen.
+func (s *server) abandon(reason string, result *scorer.Result) error {
+	return s.command(commandData{command: abandonTesting, reason: reason, result: result, automatic: true})
+}
+
+// Quarantined takes a version directory name or a jar name.
+func (s *server) Quarantined(version string) bool {
+	return s.quarantine.Contains(stripJar(version))
+}
+
+func (s *server) QuarantineList() []quarantine.Entry {
+	return s.quarantine.List()
+}
+
+func (s *server) Unquarantine(version string) error {
+	return s.command(commandData{command: unquarantine, server: version})
+}
+
+// unquarantine is run from the command watcher.
+func (s *server) unquarantine(version string) error {
+	removed, err := s.quarantine.Remove(stripJar(version))
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("Version %s is not quarantined", version)
+	}
+	log.Info("Removed ", version, " from quarantine")
+	return nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/server/servlet"
+	"github.com/cantara/vili/typelib"
+)
+
+type balancing int
+
+const (
+	roundRobin balancing = iota
+	leastConnections
+)
+
+func balancingFromString(s string) balancing {
+	switch strings.ToLower(s) {
+	case "least_connections", "leastconnections":
+		return leastConnections
+	}
+	return roundRobin
+}
+
+const (
+	maxReplicaFailures = 3
+	replicaRetryAfter  = time.Second * 10
+)
+
+var ErrNoReplicas = fmt.Errorf("No replicas available")
+
+type replica struct {
+	servlet.Servlet
+	serverType  typelib.ServerType
+	version     string
+	active      int64
+	failures    int64
+	lastFailure int64
+	retired     int32
+}
+
+// markRetired is true only the first time, so a retirement is recorded once.
+func (r *replica) markRetired() bool {
+	return atomic.CompareAndSwapInt32(&r.retired, 0, 1)
+}
+
+func (r *replica) isRetired() bool {
+	return atomic.LoadInt32(&r.retired) == 1
+}
+
+func (r *replica) healthy() bool {
+	if atomic.LoadInt64(&r.failures) < maxReplicaFailures {
+		return true
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&r.lastFailure))) > replicaRetryAfter //Let a single request through every now and then to see if it has recovered
+}
+
+func (r *replica) Done(o typelib.Observation, err error) {
+	atomic.AddInt64(&r.active, -1)
+	observeRequest(r.serverType, o, err)
+	if err == nil {
+		atomic.StoreInt64(&r.failures, 0)
+		r.IncrementRequests()
+		r.Observe(o)
+		return
+	}
+	atomic.StoreInt64(&r.lastFailure, time.Now().UnixNano())
+	if atomic.AddInt64(&r.failures, 1) == maxReplicaFailures {
+		log.Warning("Marking ", r.serverType, " replica on port ", r.Port(), " as unhealthy")
+	}
+}
+
+func (h *servletHandler) pick() (*replica, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.replicas) == 0 {
+		return nil, ErrNoReplicas
+	}
+	var chosen *replica
+	switch h.balancing {
+	case leastConnections:
+		for _, r := range h.replicas {
+			if !r.healthy() {
+				continue
+			}
+			if chosen == nil || atomic.LoadInt64(&r.active) < atomic.LoadInt64(&chosen.active) {
+				chosen = r
+			}
+		}
+	default:
+		for i := range h.replicas {
+			r := h.replicas[(h.next+i)%len(h.replicas)]
+			if !r.healthy() {
+				continue
+			}
+			chosen = r
+			h.next = (h.next + i + 1) % len(h.replicas)
+			break
+		}
+	}
+	if chosen == nil { //All replicas are unhealthy, keep sending traffic rather than dropping it
+		chosen = h.replicas[h.next%len(h.replicas)]
+		h.next = (h.next + 1) % len(h.replicas)
+	}
+	atomic.AddInt64(&chosen.active, 1)
+	return chosen, nil
+}
+
+func (h *servletHandler) contains(r *replica) bool {
+	for _, rep := range h.replicas {
+		if rep == r {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *servletHandler) remove(r *replica) bool {
+	for i, rep := range h.replicas {
+		if rep == r {
+			h.replicas = append(h.replicas[:i], h.replicas[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
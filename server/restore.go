@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/slack"
+	"github.com/cantara/vili/typelib"
+)
+
+// replaceTesting stops and archives the current testing version and clears what was known about it, it is run from the command watcher.
+func (s *server) replaceTesting() {
+	s.testing.mutex.Lock()
+	oldFolder := s.testing.dir
+	testers := s.testing.replicas
+	s.testing.replicas = nil
+	s.testing.dir = nil
+	s.testing.mutex.Unlock()
+	for _, r := range testers {
+		s.retire(r)
+	}
+	if len(testers) > 0 {
+		s.archive(oldFolder)
+	}
+	s.fingerprintMutex.Lock()
+	s.reportedFingerprints = make(map[string]bool)
+	s.fingerprintMutex.Unlock()
+	s.testing.mutex.Lock()
+	s.waiting = false
+	s.awaitingApproval = false
+	s.testing.mutex.Unlock()
+}
+
+// record adds a change of the running or testing version to the event log, from is the version it replaced.
+func (s *server) record(t eventlog.Type, version, from fslib.Dir, reason string) {
+	e := eventlog.Event{
+		Type:    t,
+		Version: version.File().Name(),
+		Message: reason,
+	}
+	if from != nil {
+		e.From = from.File().Name()
+	}
+	s.events.Add(e)
+}
+
+// archive zips away a version folder, unless replicas still run from it.
+func (s *server) archive(dir fslib.Dir) {
+	if dir == nil {
+		return
+	}
+	version := dir.File().Name()
+	for _, h := range []*servletHandler{&s.running, &s.testing, &s.previous} {
+		h.mutex.Lock()
+		inUse := false
+		for _, r := range h.replicas {
+			inUse = inUse || r.version == version
+		}
+		h.mutex.Unlock()
+		if inUse {
+			log.Warning("Not archiving ", version, ", it is still used by ", h.serverType)
+			return
+		}
+	}
+	s.oldFolders <- dir
+}
+
+func samePath(d1, d2 fslib.Dir) bool {
+	return d1 != nil && d2 != nil && d1.Path() == d2.Path()
+}
+
+// Restore starts an earlier version as testing, or replaces running with it when forced.
+// Versions that are no longer in the base folder are extracted with unarchive.
+func (s *server) Restore(version string, unarchive func(version string, dst fslib.Dir) (fslib.Dir, error), force bool) error {
+	return s.command(commandData{command: restoreVersion, server: version, unarchive: unarchive, force: force})
+}
+
+// versionDir finds version in the base folder, versions that are not archived yet are used as they are.
+func (s *server) versionDir(version string, unarchive func(version string, dst fslib.Dir) (fslib.Dir, error)) (fslib.Dir, error) {
+	serverDir, err := s.dir.Cd(version)
+	if err == nil || unarchive == nil {
+		return serverDir, err
+	}
+	return unarchive(version, s.dir)
+}
+
+// restore is run from the command watcher, the outcome is sent on errorChan.
+func (s *server) restore(serverDir fslib.Dir, force bool, errorChan chan error) {
+	version := serverDir.File().Name()
+	if samePath(serverDir, s.running.dir) {
+		errorChan <- fmt.Errorf("Version %s is allready running", version)
+		return
+	}
+	if samePath(serverDir, s.testing.dir) && s.HasTesting() {
+		errorChan <- fmt.Errorf("Version %s is allready testing", version)
+		return
+	}
+	removed, err := s.quarantine.Remove(version)
+	if err != nil {
+		errorChan <- err
+		return
+	}
+	if removed {
+		log.Info("Removed ", version, " from quarantine since it was restored by hand")
+	}
+	if !force {
+		s.replaceTesting()
+		err = s.startServiceFromWatcher(serverDir, typelib.TESTING, nil)
+		if err == nil {
+			s.record(eventlog.RESTORED, serverDir, nil, "as testing")
+			go slack.Sendf(" :rewind: Vili restored version %s as testing on host: %s, running version is %s.", version, s.hostname, s.GetRunningVersion())
+		}
+		errorChan <- err
+		return
+	}
+
+	s.endWatch()
+	oldFolder := s.running.dir
+	s.rollOut(serverDir, nil, errorChan, func(err error) error {
+		if err != nil {
+			return err
+		}
+		s.archive(oldFolder)
+		s.record(eventlog.RESTORED, serverDir, oldFolder, "forced as running")
+		go slack.Sendf(" :rewind: :warning: Vili replaced running version on host: %s with restored version %s without testing it.", s.hostname, version)
+		return nil
+	})
+}
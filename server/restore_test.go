@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/quarantine"
+)
+
+func TestRestoreUnarchivesFromWatcher(t *testing.T) {
+	s, _ := newTestServer(t)
+	errArchive := errors.New("not archived")
+	var unarchived string
+	err := s.Restore("app-0.9.0", func(version string, dst fslib.Dir) (fslib.Dir, error) {
+		unarchived = version
+		if dst.Path() != s.dir.Path() {
+			t.Errorf("Extracted to %s, expected the base folder", dst.Path())
+		}
+		return nil, errArchive
+	}, false)
+	if !errors.Is(err, errArchive) || unarchived != "app-0.9.0" {
+		t.Errorf("Restore of a version that is not in the base folder = %v, unarchived %q", err, unarchived)
+	}
+
+	versionDir(t, s, "app-1.0.0")
+	err = s.Restore("app-1.0.0", func(version string, dst fslib.Dir) (fslib.Dir, error) {
+		t.Errorf("%s is in the base folder and should not be unarchived", version)
+		return nil, errArchive
+	}, false)
+	if errors.Is(err, errArchive) {
+		t.Errorf("Restore of a version in the base folder = %v", err)
+	}
+}
+
+func TestUnquarantine(t *testing.T) {
+	s, _ := newTestServer(t)
+	if err := s.quarantine.Add(quarantine.Entry{Version: "app-1.0.0", Reason: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Unquarantine("app-1.0.0.jar"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Quarantined("app-1.0.0") {
+		t.Error("app-1.0.0 is still quarantined")
+	}
+	if err := s.Unquarantine("app-1.0.0"); err == nil {
+		t.Error("Unquarantine of a version that is not quarantined should fail")
+	}
+}
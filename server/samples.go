@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/cantara/vili/server/scorer"
+)
+
+const (
+	scoreSampleInterval = time.Second * 30
+	maxScorePoints      = 240 //Two hours of samples
+	maxMismatches       = 50
+)
+
+type ScorePoint struct {
+	Time    time.Time      `json:"time"`
+	Version string         `json:"version"`
+	Score   float64        `json:"score"`
+	Verdict scorer.Verdict `json:"verdict"`
+}
+
+// Mismatch is a shadowed request that was answered differently than by running.
+type Mismatch struct {
+	Time     time.Time `json:"time"`
+	Role     string    `json:"role"`
+	Version  string    `json:"version"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Route    string    `json:"route"`
+	Expected int       `json:"expected"`
+	Got      int       `json:"got"`
+	TraceID  string    `json:"trace_id,omitempty"`
+}
+
+// sampleScores keeps the recent scores of testing for the dashboard.
+func (s *server) sampleScores(ctx context.Context) {
+	ticker := time.NewTicker(scoreSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if !s.HasTesting() {
+			continue
+		}
+		result, err := s.ReliabilityScore()
+		if err != nil {
+			continue
+		}
+		p := ScorePoint{
+			Time:    time.Now(),
+			Version: s.GetTestingVersion(),
+			Score:   finiteScore(result.Score),
+			Verdict: result.Verdict,
+		}
+		s.samplesMutex.Lock()
+		s.scores = append(s.scores, p)
+		if len(s.scores) > maxScorePoints {
+			s.scores = s.scores[len(s.scores)-maxScorePoints:]
+		}
+		s.samplesMutex.Unlock()
+	}
+}
+
+func finiteScore(score float64) float64 {
+	if math.IsInf(score, 0) || math.IsNaN(score) { //Without requests the headroom is infinite, which json can't show
+		return 0
+	}
+	return score
+}
+
+func (s *server) Scores() []ScorePoint {
+	s.samplesMutex.Lock()
+	defer s.samplesMutex.Unlock()
+	return append([]ScorePoint(nil), s.scores...)
+}
+
+func (s *server) AddMismatch(m Mismatch) {
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	s.samplesMutex.Lock()
+	defer s.samplesMutex.Unlock()
+	s.mismatches = append(s.mismatches, m)
+	if len(s.mismatches) > maxMismatches {
+		s.mismatches = s.mismatches[len(s.mismatches)-maxMismatches:]
+	}
+}
+
+// Mismatches returns the recent mismatches, newest first.
+func (s *server) Mismatches() []Mismatch {
+	s.samplesMutex.Lock()
+	defer s.samplesMutex.Unlock()
+	mismatches := make([]Mismatch, len(s.mismatches))
+	for i, m := range s.mismatches {
+		mismatches[len(mismatches)-1-i] = m
+	}
+	return mismatches
+}
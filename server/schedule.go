@@ -0,0 +1,68 @@
+package server
+
+import (
+	"time"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/slack"
+)
+
+func (s *server) isWaiting() bool {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	return s.waiting || s.awaitingApproval
+}
+
+// awaitWindow marks testing as passed and promotes it when the next deploy window opens.
+func (s *server) awaitWindow(reason string) {
+	s.testing.mutex.Lock()
+	if s.waiting || s.testing.isDying || len(s.testing.replicas) == 0 {
+		s.testing.mutex.Unlock()
+		return
+	}
+	s.waiting = true
+	serverDir := s.testing.dir
+	s.testing.mutex.Unlock()
+
+	next := s.schedule.Next(time.Now())
+	if next.IsZero() {
+		log.Warning("No deploy window within a year, testing version ", serverDir.File().Name(), " will wait until it is deployed by hand")
+		go slack.Sendf(" :no_entry: Vili testing version %s on host: %s passed but there is no deploy window within a year. %s.", serverDir.File().Name(), s.hostname, reason)
+		return
+	}
+	log.Info("Testing version ", serverDir.File().Name(), " passed, waiting for deploy window at ", next)
+	go slack.Sendf(" :hourglass_flowing_sand: Vili testing version %s on host: %s passed and waits for the deploy window at %s. %s.", serverDir.File().Name(), s.hostname, next.In(s.schedule.Location).Format(time.RFC1123), reason)
+	time.AfterFunc(time.Until(next), func() {
+		s.promoteWaiting(serverDir.Path())
+	})
+}
+
+func (s *server) promoteWaiting(serverDir string) {
+	s.testing.mutex.Lock()
+	stillWaiting := s.waiting && s.testing.dir != nil && s.testing.dir.Path() == serverDir
+	paused := s.paused || s.frozen || s.freezeFileExists()
+	if paused {
+		s.waiting = false //Passing is checked again when promotion is resumed
+	}
+	s.testing.mutex.Unlock()
+	if !stillWaiting || paused {
+		return
+	}
+	if !s.schedule.Allowed(time.Now()) { //The clock or timezone moved under us
+		s.testing.mutex.Lock()
+		s.waiting = false
+		s.testing.mutex.Unlock()
+		s.awaitWindow("deploy window moved")
+		return
+	}
+	if !s.claimTesting() {
+		return
+	}
+	go slack.Sendf(" :hourglass: Vili deploy window opened, switching on host: %s from version %s to %s.", s.hostname, s.GetRunningVersion(), s.GetTestingVersion())
+	err := s.deploy()
+	if err != nil {
+		log.AddError(err).Error("While deploying waiting testing version")
+		return
+	}
+	go slack.Sendf(" :white_check_mark:  Vili switch to new version complete on host: %s, version %s.", s.hostname, s.GetRunningVersion())
+}
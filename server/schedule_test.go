@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cantara/vili/schedule"
+	"github.com/cantara/vili/typelib"
+)
+
+func TestDeployOutsideWindow(t *testing.T) {
+	s, _ := newTestServer(t)
+	addReplica(s, typelib.RUNNING, versionDir(t, s, "app-1.0.0"))
+	addReplica(s, typelib.TESTING, versionDir(t, s, "app-1.1.0"))
+	blackout, err := schedule.ParseBlackout(time.Now().Format("2006-01-02") + ".." + time.Now().AddDate(0, 0, 1).Format("2006-01-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.schedule = schedule.Schedule{Blackouts: []schedule.Blackout{blackout}, Location: time.Local}
+	waiting := func() bool {
+		s.testing.mutex.Lock()
+		defer s.testing.mutex.Unlock()
+		return s.waiting
+	}
+
+	if queued, err := s.Deploy(false); !errors.Is(err, ErrOutsideDeployWindow) || queued {
+		t.Errorf("Deploy without waiting = %v, %v, expected %v", queued, err, ErrOutsideDeployWindow)
+	}
+	if waiting() {
+		t.Error("Testing waits for the deploy window after a deploy that was not to wait")
+	}
+	if queued, err := s.Deploy(true); err != nil || !queued {
+		t.Errorf("Deploy = %v, %v, expected it to be queued", queued, err)
+	}
+	if !waiting() || s.GetRunningVersion() != "app-1.0.0" {
+		t.Errorf("Testing is not waiting for the deploy window, running is %s", s.GetRunningVersion())
+	}
+}
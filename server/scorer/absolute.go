@@ -0,0 +1,51 @@
+package scorer
+
+import (
+	"fmt"
+
+	"github.com/cantara/vili/envlib"
+	"github.com/cantara/vili/typelib"
+)
+
+// Absolute is the original points formula, where every request is worth one point and breaking responses, errors and
+// warnings cost points. Testing is promoted when it has at most lost Threshold points compared to running.
+// The original subtracted testing from running, which promoted testing with more errors and kept testing with fewer,
+// so the score is testing minus running instead. Running usually gets far more requests than testing, so its points
+// are scaled down to the requests testing got.
+type Absolute struct {
+	Checks
+	Threshold          float64
+	NewFingerprintCost int64
+}
+
+func AbsoluteFromEnv() Absolute {
+	return Absolute{
+		Checks:             ChecksFromEnv(),
+		Threshold:          envlib.Float("score_threshold", -50),
+		NewFingerprintCost: int64(envlib.Int("new_fingerprint_penalty", 500)),
+	}
+}
+
+func points(c typelib.Counters) int64 {
+	return c.Requests - c.Breaking*100 - c.Errors*10 - c.Warnings - c.Weight
+}
+
+// scaledPoints is what running would have scored with as many requests as testing.
+func scaledPoints(running typelib.Counters, requests int64) float64 {
+	if running.Requests == 0 {
+		return float64(points(running))
+	}
+	return float64(points(running)) * float64(requests) / float64(running.Requests)
+}
+
+func (conf Absolute) Score(in Input) (r Result) {
+	running := scaledPoints(in.Running, in.Testing.Requests)
+	r.Score = float64(points(in.Testing)) - running - float64(int64(in.NewFingerprints)*conf.NewFingerprintCost)
+	r.Summary = fmt.Sprintf("running %.0f points at testings %d requests, testing %d points, threshold %.0f", running, in.Testing.Requests, points(in.Testing), conf.Threshold)
+	r.Verdict = PROMOTE
+	if r.Score < conf.Threshold {
+		r.keep("score %.0f is below %.0f", r.Score, conf.Threshold)
+	}
+	conf.check(in, &r)
+	return
+}
@@ -0,0 +1,105 @@
+package scorer
+
+import (
+	"fmt"
+
+	"github.com/cantara/vili/envlib"
+	"github.com/cantara/vili/procstat"
+)
+
+// Checks are the route, status code, resource and warm-up checks every scorer applies on top of its own formula,
+// so choosing a scorer only changes how the overall counters are compared.
+type Checks struct {
+	Confidence           float64
+	MaxBreakingRate      float64
+	MinRouteRequests     int64
+	RouteErrorRateMargin float64
+	ServerErrorMargin    float64
+	ClientErrorMargin    float64
+	MinResourceSamples   int
+	MaxResourceRatio     float64
+	MaxMemoryGrowth      float64
+	WarmupErrorMargin    int64
+}
+
+func ChecksFromEnv() Checks {
+	return Checks{
+		Confidence:           envlib.Float("confidence", 0.95),
+		MaxBreakingRate:      envlib.Float("max_breaking_rate", 0.01),
+		MinRouteRequests:     int64(envlib.Int("min_route_requests", 30)),
+		RouteErrorRateMargin: envlib.Float("route_error_rate_margin", 0.01),
+		ServerErrorMargin:    envlib.Float("server_error_margin", 0.005),
+		ClientErrorMargin:    envlib.Float("client_error_margin", 0.05),
+		MinResourceSamples:   envlib.Int("min_resource_samples", 10),
+		MaxResourceRatio:     envlib.Float("max_resource_ratio", 1.5),
+		MaxMemoryGrowth:      envlib.Float("max_memory_growth", 0.2),
+		WarmupErrorMargin:    int64(envlib.Int("warmup_error_margin", 5)),
+	}
+}
+
+func (r *Result) keep(format string, a ...interface{}) {
+	if r.Verdict == PROMOTE {
+		r.Verdict = KEEP
+	}
+	r.Reasons = append(r.Reasons, fmt.Sprintf(format, a...))
+}
+
+func (r *Result) reject(format string, a ...interface{}) {
+	r.Verdict = REJECT
+	r.Reasons = append(r.Reasons, fmt.Sprintf(format, a...))
+}
+
+// check fills in the routes and status comparison of r and keeps or rejects testing on them, on warm-up and on resources.
+func (conf Checks) check(in Input, r *Result) {
+	var failedRoutes []string
+	r.Routes, failedRoutes = conf.scoreRoutes(in)
+	r.Status = compareStatus(in, conf.ServerErrorMargin, conf.ClientErrorMargin)
+
+	warmupErrors := in.TestingWarmup.Errors + in.TestingWarmup.Weight
+	runningWarmupErrors := in.RunningWarmup.Errors + in.RunningWarmup.Weight
+	if warmupErrors > runningWarmupErrors+conf.WarmupErrorMargin { //Warm-up does not get better with more traffic
+		r.reject("%d errors during warm-up, running had %d", warmupErrors, runningWarmupErrors)
+	}
+	for _, failed := range failedRoutes {
+		r.reject("%s", failed)
+	}
+	alpha := 1 - conf.Confidence
+	if r.Status.ServerErrorPValue < alpha {
+		r.reject("5xx share increased from %.2f%% to %.2f%% (p=%.4f)", share(r.Status.Running, 5)*100, share(r.Status.Testing, 5)*100, r.Status.ServerErrorPValue)
+	}
+	if r.Status.ClientErrorPValue < alpha {
+		r.keep("4xx share changed from %.2f%% to %.2f%% (p=%.4f)", share(r.Status.Running, 4)*100, share(r.Status.Testing, 4)*100, r.Status.ClientErrorPValue)
+	}
+	for _, reason := range conf.checkResources(in.RunningResources, in.TestingResources) {
+		r.keep("%s", reason)
+	}
+}
+
+const steadyGrowthFit = 0.8
+
+func (conf Checks) checkResources(running, testing procstat.Summary) (reasons []string) {
+	if testing.Samples < conf.MinResourceSamples {
+		return
+	}
+	if testing.RSSGrowth > conf.MaxMemoryGrowth && testing.RSSGrowthFit >= steadyGrowthFit {
+		reasons = append(reasons, fmt.Sprintf("memory grew steadily by %.0f%% over %.1fh", testing.RSSGrowth*100, testing.DurationHours))
+	}
+	if running.Samples < conf.MinResourceSamples {
+		return
+	}
+	for _, resource := range []struct {
+		name             string
+		running, testing float64
+	}{
+		{"memory", running.MeanRSS, testing.MeanRSS},
+		{"cpu", running.MeanCPU, testing.MeanCPU},
+		{"threads", running.MeanThreads, testing.MeanThreads},
+		{"file descriptors", running.MeanFDs, testing.MeanFDs},
+	} {
+		if resource.running <= 0 || resource.testing <= resource.running*conf.MaxResourceRatio {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("uses %.1f times the %s of running", resource.testing/resource.running, resource.name))
+	}
+	return
+}
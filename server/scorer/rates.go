@@ -0,0 +1,74 @@
+package scorer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/cantara/vili/envlib"
+	"github.com/cantara/vili/stats"
+)
+
+// Rates compares per request rates. Testing is promoted when, with the configured confidence, its rates are at most
+// the running rates plus a margin, and rejected when it is just as confidently worse.
+// Upper bounds are used for promotion so low traffic gives wide bounds and is not promoted on noise.
+type Rates struct {
+	Checks
+	MinRequests        int64
+	ErrorRateMargin    float64
+	WarningRateMargin  float64
+	MaxNewFingerprints int
+}
+
+func RatesFromEnv() Rates {
+	return Rates{
+		Checks:             ChecksFromEnv(),
+		MinRequests:        int64(envlib.Int("min_requests", 100)),
+		ErrorRateMargin:    envlib.Float("error_rate_margin", 0.01),
+		WarningRateMargin:  envlib.Float("warning_rate_margin", 0.05),
+		MaxNewFingerprints: envlib.Int("max_new_fingerprints", 0),
+	}
+}
+
+func (conf Rates) Score(in Input) (r Result) {
+	running, testing := in.Running, in.Testing
+	var runningErrorRate, runningWarningRate float64
+	if running.Requests > 0 {
+		runningErrorRate = float64(running.Errors+running.Weight) / float64(running.Requests)
+		runningWarningRate = float64(running.Warnings) / float64(running.Requests)
+	}
+	allowedErrorRate := runningErrorRate + conf.ErrorRateMargin
+	allowedWarningRate := runningWarningRate + conf.WarningRateMargin
+	breakingUpper := stats.WilsonUpper(testing.Breaking, testing.Requests, conf.Confidence)
+	breakingLower := stats.WilsonLower(testing.Breaking, testing.Requests, conf.Confidence)
+	errorUpper := stats.RateUpper(testing.Errors+testing.Weight, testing.Requests, conf.Confidence)
+	errorLower := stats.RateLower(testing.Errors+testing.Weight, testing.Requests, conf.Confidence)
+	warningUpper := stats.RateUpper(testing.Warnings, testing.Requests, conf.Confidence)
+
+	r.Verdict = PROMOTE
+	r.Score = math.Min(allowedErrorRate-errorUpper, conf.MaxBreakingRate-breakingUpper) //Headroom to the closest limit, negative means not good enough yet
+	r.Summary = fmt.Sprintf("%.0f%% confidence, requests %d/%d, errors/req %.4f vs <=%.4f, warnings/req %.4f vs <=%.4f, breaking <=%.2f%%, rss %.0fMB/%.0fMB",
+		conf.Confidence*100, running.Requests, testing.Requests, runningErrorRate, errorUpper, runningWarningRate, warningUpper, breakingUpper*100,
+		in.TestingResources.MeanRSS/(1<<20), in.RunningResources.MeanRSS/(1<<20))
+	conf.check(in, &r)
+	if testing.Requests < conf.MinRequests || running.Requests < conf.MinRequests {
+		r.keep("not enough requests, need %d got running %d and testing %d", conf.MinRequests, running.Requests, testing.Requests)
+		return //Lower bounds are not trusted before there is enough data either
+	}
+	if breakingLower > conf.MaxBreakingRate {
+		r.reject("breaking rate is atleast %.2f%%, max is %.2f%%", breakingLower*100, conf.MaxBreakingRate*100)
+	} else if breakingUpper > conf.MaxBreakingRate {
+		r.keep("breaking rate could be %.2f%%, max is %.2f%%", breakingUpper*100, conf.MaxBreakingRate*100)
+	}
+	if errorLower > allowedErrorRate {
+		r.reject("error rate is atleast %.4f per request, running has %.4f", errorLower, runningErrorRate)
+	} else if errorUpper > allowedErrorRate {
+		r.keep("error rate could be %.4f per request, running has %.4f", errorUpper, runningErrorRate)
+	}
+	if warningUpper > allowedWarningRate {
+		r.keep("warning rate could be %.4f per request, running has %.4f", warningUpper, runningWarningRate)
+	}
+	if in.NewFingerprints > conf.MaxNewFingerprints {
+		r.keep("%d new exception types", in.NewFingerprints)
+	}
+	return
+}
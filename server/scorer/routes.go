@@ -0,0 +1,104 @@
+package scorer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cantara/vili/stats"
+	"github.com/cantara/vili/typelib"
+)
+
+const maxReportedRoutes = 10
+
+type RouteResult struct {
+	Route                  string        `json:"route"`
+	Requests               int64         `json:"requests"`
+	Breaking               int64         `json:"breaking"`
+	RunningServerErrorRate float64       `json:"running_server_error_rate"`
+	TestingServerErrorRate float64       `json:"testing_server_error_rate"`
+	RunningLatency         time.Duration `json:"running_latency"`
+	TestingLatency         time.Duration `json:"testing_latency"`
+	Pass                   bool          `json:"pass"`
+	badness                float64
+}
+
+func (r RouteResult) String() string {
+	return fmt.Sprintf("%s 5xx %.1f%% vs %.1f%%, breaking %d/%d, %s vs %s", r.Route, r.TestingServerErrorRate*100, r.RunningServerErrorRate*100,
+		r.Breaking, r.Requests, r.TestingLatency.Round(time.Millisecond), r.RunningLatency.Round(time.Millisecond))
+}
+
+func serverErrorRate(c typelib.RouteCounters) float64 {
+	if c.Requests == 0 {
+		return 0
+	}
+	return float64(c.StatusClasses[5]) / float64(c.Requests)
+}
+
+// scoreRoutes fails routes with enough samples where testing is worse with the configured confidence.
+// The confidence is corrected for the number of routes so many routes don't give false failures.
+func (conf Checks) scoreRoutes(in Input) (routes []RouteResult, failed []string) {
+	var sampled int
+	for _, c := range in.TestingRoutes {
+		if c.Requests >= conf.MinRouteRequests {
+			sampled++
+		}
+	}
+	routeConfidence := 1 - (1-conf.Confidence)/float64(max(sampled, 1))
+	for route, testing := range in.TestingRoutes {
+		running := in.RunningRoutes[route]
+		r := RouteResult{
+			Route:                  route,
+			Requests:               testing.Requests,
+			Breaking:               testing.Breaking,
+			RunningServerErrorRate: serverErrorRate(running),
+			TestingServerErrorRate: serverErrorRate(testing),
+			RunningLatency:         running.MeanLatency(),
+			TestingLatency:         testing.MeanLatency(),
+			Pass:                   true,
+		}
+		var breakingRate float64
+		if testing.Requests > 0 {
+			breakingRate = float64(testing.Breaking) / float64(testing.Requests)
+		}
+		r.badness = math.Max(breakingRate, r.TestingServerErrorRate-r.RunningServerErrorRate)
+		if testing.Requests >= conf.MinRouteRequests {
+			if stats.WilsonLower(testing.Breaking, testing.Requests, routeConfidence) > conf.MaxBreakingRate {
+				r.Pass = false
+				failed = append(failed, fmt.Sprintf("route %s has %d/%d breaking responses", route, testing.Breaking, testing.Requests))
+			}
+			if stats.WilsonLower(testing.StatusClasses[5], testing.Requests, routeConfidence) > r.RunningServerErrorRate+conf.RouteErrorRateMargin {
+				r.Pass = false
+				failed = append(failed, fmt.Sprintf("route %s has %.1f%% 5xx, running has %.1f%%", route, r.TestingServerErrorRate*100, r.RunningServerErrorRate*100))
+			}
+		}
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].badness != routes[j].badness {
+			return routes[i].badness > routes[j].badness
+		}
+		return routes[i].Requests > routes[j].Requests
+	})
+	sort.Strings(failed)
+	if len(routes) > maxReportedRoutes {
+		routes = routes[:maxReportedRoutes]
+	}
+	return
+}
+
+func (r Result) WorstRoutes() string {
+	if len(r.Routes) == 0 {
+		return "none"
+	}
+	worst := make([]string, 0, 3)
+	for _, route := range r.Routes {
+		if len(worst) == cap(worst) {
+			break
+		}
+		worst = append(worst, route.String())
+	}
+	return strings.Join(worst, "; ")
+}
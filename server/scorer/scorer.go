@@ -0,0 +1,80 @@
+package scorer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cantara/vili/procstat"
+	"github.com/cantara/vili/typelib"
+)
+
+type Verdict int
+
+const (
+	KEEP Verdict = iota
+	PROMOTE
+	REJECT
+)
+
+func (v Verdict) String() string {
+	return []string{"keep testing", "promote", "reject"}[v]
+}
+
+func (v Verdict) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Verdict) UnmarshalText(text []byte) error {
+	for _, verdict := range []Verdict{KEEP, PROMOTE, REJECT} {
+		if verdict.String() == string(text) {
+			*v = verdict
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown verdict %q", text)
+}
+
+type Input struct {
+	Running          typelib.Counters
+	Testing          typelib.Counters
+	RunningRoutes    map[string]typelib.RouteCounters
+	TestingRoutes    map[string]typelib.RouteCounters
+	RunningWarmup    typelib.Counters
+	TestingWarmup    typelib.Counters
+	RunningResources procstat.Summary
+	TestingResources procstat.Summary
+	NewFingerprints  int
+	Duration         time.Duration
+}
+
+type Result struct {
+	Verdict Verdict          `json:"verdict"`
+	Score   float64          `json:"score"`
+	Summary string           `json:"summary"`
+	Reasons []string         `json:"reasons"`
+	Routes  []RouteResult    `json:"routes"`
+	Status  StatusComparison `json:"status"`
+}
+
+func (r Result) String() string {
+	if len(r.Reasons) == 0 {
+		return fmt.Sprintf("%s with score %.4f (%s, status testing/running %s)", r.Verdict, r.Score, r.Summary, r.Status)
+	}
+	return fmt.Sprintf("%s with score %.4f because %s (%s, status testing/running %s)", r.Verdict, r.Score, strings.Join(r.Reasons, "; "), r.Summary, r.Status)
+}
+
+type Scorer interface {
+	Score(Input) Result
+}
+
+func FromEnv() (Scorer, error) {
+	switch strings.ToLower(os.Getenv("scorer")) {
+	case "", "rates":
+		return RatesFromEnv(), nil
+	case "absolute":
+		return AbsoluteFromEnv(), nil
+	}
+	return nil, fmt.Errorf("Unknown scorer %s", os.Getenv("scorer"))
+}
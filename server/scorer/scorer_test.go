@@ -0,0 +1,292 @@
+package scorer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cantara/vili/procstat"
+	"github.com/cantara/vili/typelib"
+)
+
+var defaultChecks = Checks{
+	Confidence:           0.95,
+	MaxBreakingRate:      0.01,
+	MinRouteRequests:     30,
+	RouteErrorRateMargin: 0.01,
+	ServerErrorMargin:    0.005,
+	ClientErrorMargin:    0.05,
+	MinResourceSamples:   10,
+	MaxResourceRatio:     1.5,
+	MaxMemoryGrowth:      0.2,
+	WarmupErrorMargin:    5,
+}
+
+var defaultRates = Rates{
+	Checks:             defaultChecks,
+	MinRequests:        100,
+	ErrorRateMargin:    0.01,
+	WarningRateMargin:  0.05,
+	MaxNewFingerprints: 0,
+}
+
+func TestRates(t *testing.T) {
+	tests := []struct {
+		name    string
+		running typelib.Counters
+		testing typelib.Counters
+		newFps  int
+		verdict Verdict
+	}{
+		{"too few requests", typelib.Counters{Requests: 50}, typelib.Counters{Requests: 50}, 0, KEEP},
+		{"clean with enough traffic", typelib.Counters{Requests: 5000}, typelib.Counters{Requests: 2000}, 0, PROMOTE},
+		{"clean but bounds too wide", typelib.Counters{Requests: 5000}, typelib.Counters{Requests: 150}, 0, KEEP},
+		{"same error rate", typelib.Counters{Requests: 10000, Errors: 500}, typelib.Counters{Requests: 5000, Errors: 250}, 0, PROMOTE},
+		{"clearly more errors", typelib.Counters{Requests: 10000, Errors: 100}, typelib.Counters{Requests: 5000, Errors: 500}, 0, REJECT},
+		{"log rule weight counts as errors", typelib.Counters{Requests: 10000}, typelib.Counters{Requests: 5000, Weight: 500}, 0, REJECT},
+		{"slightly more errors", typelib.Counters{Requests: 10000, Errors: 100}, typelib.Counters{Requests: 1000, Errors: 20}, 0, KEEP},
+		{"breaking responses", typelib.Counters{Requests: 10000}, typelib.Counters{Requests: 5000, Breaking: 200}, 0, REJECT},
+		{"few breaking responses", typelib.Counters{Requests: 10000}, typelib.Counters{Requests: 5000, Breaking: 5}, 0, PROMOTE},
+		{"many warnings", typelib.Counters{Requests: 10000}, typelib.Counters{Requests: 2000, Warnings: 400}, 0, KEEP},
+		{"new exception types", typelib.Counters{Requests: 5000}, typelib.Counters{Requests: 2000}, 1, KEEP},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := defaultRates.Score(Input{Running: test.running, Testing: test.testing, NewFingerprints: test.newFps, Duration: time.Minute * 10})
+			if r.Verdict != test.verdict {
+				t.Errorf("Got %s", r)
+			}
+			if r.Verdict != PROMOTE && len(r.Reasons) == 0 {
+				t.Error("No reasons given for not promoting")
+			}
+		})
+	}
+}
+
+func TestAbsolute(t *testing.T) {
+	conf := Absolute{Checks: defaultChecks, Threshold: -50, NewFingerprintCost: 500}
+	tests := []struct {
+		name    string
+		running typelib.Counters
+		testing typelib.Counters
+		newFps  int
+		verdict Verdict
+		score   float64
+	}{
+		{"equal", typelib.Counters{Requests: 100}, typelib.Counters{Requests: 100}, 0, PROMOTE, 0},
+		{"a few more warnings", typelib.Counters{Requests: 100}, typelib.Counters{Requests: 100, Warnings: 40}, 0, PROMOTE, -40},
+		{"breaking responses", typelib.Counters{Requests: 100}, typelib.Counters{Requests: 100, Breaking: 1}, 0, KEEP, -100},
+		{"more errors", typelib.Counters{Requests: 100, Errors: 1}, typelib.Counters{Requests: 100, Errors: 7}, 0, KEEP, -60},
+		{"new exception type", typelib.Counters{Requests: 100}, typelib.Counters{Requests: 100}, 1, KEEP, -500},
+		{"less traffic than running", typelib.Counters{Requests: 10000}, typelib.Counters{Requests: 2000}, 0, PROMOTE, 0},
+		{"same error rate with less traffic", typelib.Counters{Requests: 10000, Errors: 50}, typelib.Counters{Requests: 2000, Errors: 10}, 0, PROMOTE, 0},
+		{"more errors with less traffic", typelib.Counters{Requests: 10000, Errors: 50}, typelib.Counters{Requests: 2000, Errors: 30}, 0, KEEP, -200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := conf.Score(Input{Running: test.running, Testing: test.testing, NewFingerprints: test.newFps})
+			if r.Verdict != test.verdict || r.Score != test.score {
+				t.Errorf("Got %s, expected %s with score %.0f", r, test.verdict, test.score)
+			}
+		})
+	}
+}
+
+func TestDefaultScorer(t *testing.T) {
+	t.Setenv("scorer", "")
+	sc, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sc.(Rates); !ok {
+		t.Errorf("Default scorer is %T, expected rates", sc)
+	}
+	r := sc.Score(Input{Running: typelib.Counters{Requests: 10000}, Testing: typelib.Counters{Requests: 2000}})
+	if r.Verdict != PROMOTE {
+		t.Errorf("Clean testing with less traffic than running was not promoted, %s", r)
+	}
+	r = sc.Score(Input{Running: typelib.Counters{Requests: 10000, Errors: 100}, Testing: typelib.Counters{Requests: 2000, Errors: 200}})
+	if r.Verdict == PROMOTE {
+		t.Errorf("Testing with more errors than running was promoted, %s", r)
+	}
+}
+
+func TestAbsoluteChecks(t *testing.T) {
+	ok := typelib.RouteCounters{Requests: 1900, StatusClasses: [6]int64{0, 0, 1900}}
+	tests := []struct {
+		name    string
+		in      Input
+		verdict Verdict
+	}{
+		{"failing route", Input{
+			RunningRoutes: map[string]typelib.RouteCounters{"GET /a": ok, "GET /b": {Requests: 100, StatusClasses: [6]int64{0, 0, 100}}},
+			TestingRoutes: map[string]typelib.RouteCounters{"GET /a": ok, "GET /b": {Requests: 50, StatusClasses: [6]int64{0, 0, 30, 0, 0, 20}}},
+		}, REJECT},
+		{"noisy warm-up", Input{RunningWarmup: typelib.Counters{Errors: 2}, TestingWarmup: typelib.Counters{Errors: 20}}, REJECT},
+		{"double memory", Input{
+			RunningResources: procstat.Summary{Samples: 20, MeanRSS: 100 << 20},
+			TestingResources: procstat.Summary{Samples: 20, MeanRSS: 200 << 20},
+		}, KEEP},
+	}
+	conf := Absolute{Checks: defaultChecks, Threshold: -50, NewFingerprintCost: 500}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.in.Running = typelib.Counters{Requests: 5000}
+			test.in.Testing = typelib.Counters{Requests: 2000}
+			r := conf.Score(test.in)
+			if r.Verdict != test.verdict {
+				t.Errorf("Got %s", r)
+			}
+		})
+	}
+}
+
+func TestRatesRoutes(t *testing.T) {
+	ok := typelib.RouteCounters{Requests: 1900, StatusClasses: [6]int64{0, 0, 1900}}
+	tests := []struct {
+		name    string
+		running map[string]typelib.RouteCounters
+		testing map[string]typelib.RouteCounters
+		verdict Verdict
+		worst   string
+	}{
+		{
+			"rare route failing",
+			map[string]typelib.RouteCounters{"GET /a": ok, "GET /b": {Requests: 100, StatusClasses: [6]int64{0, 0, 100}}},
+			map[string]typelib.RouteCounters{"GET /a": ok, "GET /b": {Requests: 50, StatusClasses: [6]int64{0, 0, 30, 0, 0, 20}}},
+			REJECT, "GET /b",
+		},
+		{
+			"rare route without enough samples",
+			map[string]typelib.RouteCounters{"GET /a": ok},
+			map[string]typelib.RouteCounters{"GET /a": ok, "GET /b": {Requests: 5, StatusClasses: [6]int64{0, 0, 0, 0, 0, 5}}},
+			PROMOTE, "GET /b",
+		},
+		{
+			"breaking route",
+			map[string]typelib.RouteCounters{"GET /a": ok},
+			map[string]typelib.RouteCounters{"GET /a": ok, "GET /b": {Requests: 60, Breaking: 20, StatusClasses: [6]int64{0, 0, 40, 0, 20}}},
+			REJECT, "GET /b",
+		},
+		{
+			"5xx on running too",
+			map[string]typelib.RouteCounters{"GET /a": ok, "GET /b": {Requests: 100, StatusClasses: [6]int64{0, 0, 60, 0, 0, 40}}},
+			map[string]typelib.RouteCounters{"GET /a": ok, "GET /b": {Requests: 50, StatusClasses: [6]int64{0, 0, 30, 0, 0, 20}}},
+			PROMOTE, "GET /a",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := defaultRates.Score(Input{
+				Running:       typelib.Counters{Requests: 5000},
+				Testing:       typelib.Counters{Requests: 2000},
+				RunningRoutes: test.running,
+				TestingRoutes: test.testing,
+			})
+			if r.Verdict != test.verdict {
+				t.Errorf("Got %s", r)
+			}
+			if len(r.Routes) == 0 || r.Routes[0].Route != test.worst {
+				t.Errorf("Worst route is not %s: %s", test.worst, r.WorstRoutes())
+			}
+		})
+	}
+}
+
+func TestStatusDistribution(t *testing.T) {
+	tests := []struct {
+		name    string
+		running [6]int64
+		testing [6]int64
+		verdict Verdict
+	}{
+		{"same distribution", [6]int64{0, 0, 4500, 0, 400, 100}, [6]int64{0, 0, 1800, 0, 160, 40}, PROMOTE},
+		{"more 5xx", [6]int64{0, 0, 4500, 0, 400, 100}, [6]int64{0, 0, 1700, 0, 160, 140}, REJECT},
+		{"fewer 4xx", [6]int64{0, 0, 4000, 0, 1000, 0}, [6]int64{0, 0, 1900, 0, 100, 0}, KEEP},
+		{"slightly more 4xx", [6]int64{0, 0, 4600, 0, 400, 0}, [6]int64{0, 0, 1830, 0, 170, 0}, PROMOTE},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := defaultRates.Score(Input{
+				Running:       typelib.Counters{Requests: total(test.running)},
+				Testing:       typelib.Counters{Requests: total(test.testing)},
+				RunningRoutes: map[string]typelib.RouteCounters{"GET /a": {Requests: total(test.running), StatusClasses: test.running}},
+				TestingRoutes: map[string]typelib.RouteCounters{"GET /a": {Requests: total(test.testing), StatusClasses: test.testing}},
+			})
+			if r.Verdict != test.verdict {
+				t.Errorf("Got %s", r)
+			}
+		})
+	}
+}
+
+func TestResources(t *testing.T) {
+	running := procstat.Summary{Samples: 20, MeanRSS: 100 << 20, MeanCPU: 0.2, MeanThreads: 30, MeanFDs: 50}
+	tests := []struct {
+		name    string
+		testing procstat.Summary
+		verdict Verdict
+	}{
+		{"same usage", procstat.Summary{Samples: 20, MeanRSS: 110 << 20, MeanCPU: 0.25, MeanThreads: 30, MeanFDs: 55}, PROMOTE},
+		{"too few samples", procstat.Summary{Samples: 5, MeanRSS: 400 << 20, MeanCPU: 0.2, MeanThreads: 30, MeanFDs: 50}, PROMOTE},
+		{"double memory", procstat.Summary{Samples: 20, MeanRSS: 200 << 20, MeanCPU: 0.2, MeanThreads: 30, MeanFDs: 50}, KEEP},
+		{"leaking fds", procstat.Summary{Samples: 20, MeanRSS: 100 << 20, MeanCPU: 0.2, MeanThreads: 30, MeanFDs: 500}, KEEP},
+		{"steady memory growth", procstat.Summary{Samples: 20, MeanRSS: 100 << 20, RSSGrowth: 0.5, RSSGrowthFit: 0.95, MeanCPU: 0.2, MeanThreads: 30, MeanFDs: 50}, KEEP},
+		{"noisy memory growth", procstat.Summary{Samples: 20, MeanRSS: 100 << 20, RSSGrowth: 0.5, RSSGrowthFit: 0.3, MeanCPU: 0.2, MeanThreads: 30, MeanFDs: 50}, PROMOTE},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := defaultRates.Score(Input{
+				Running:          typelib.Counters{Requests: 5000},
+				Testing:          typelib.Counters{Requests: 2000},
+				RunningResources: running,
+				TestingResources: test.testing,
+				Duration:         time.Minute * 10,
+			})
+			if r.Verdict != test.verdict {
+				t.Errorf("Got %s", r)
+			}
+		})
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	tests := []struct {
+		name    string
+		running typelib.Counters
+		testing typelib.Counters
+		verdict Verdict
+	}{
+		{"quiet warm-up", typelib.Counters{Errors: 2}, typelib.Counters{Errors: 3}, PROMOTE},
+		{"noisy warm-up like running", typelib.Counters{Errors: 40}, typelib.Counters{Errors: 44}, PROMOTE},
+		{"noisy warm-up", typelib.Counters{Errors: 2}, typelib.Counters{Errors: 20}, REJECT},
+		{"weighted warm-up", typelib.Counters{}, typelib.Counters{Errors: 1, Weight: 10}, REJECT},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := defaultRates.Score(Input{
+				Running:       typelib.Counters{Requests: 5000},
+				Testing:       typelib.Counters{Requests: 2000},
+				RunningWarmup: test.running,
+				TestingWarmup: test.testing,
+				Duration:      time.Minute * 10,
+			})
+			if r.Verdict != test.verdict {
+				t.Errorf("Got %s", r)
+			}
+		})
+	}
+}
+
+func TestVerdictJSON(t *testing.T) {
+	for _, v := range []Verdict{KEEP, PROMOTE, REJECT} {
+		data, err := json.Marshal(Result{Verdict: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r Result
+		if err = json.Unmarshal(data, &r); err != nil || r.Verdict != v {
+			t.Errorf("Verdict %s came back as %s, %v", v, r.Verdict, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package scorer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/cantara/vili/stats"
+)
+
+type StatusComparison struct {
+	Running           [6]int64 `json:"running"`
+	Testing           [6]int64 `json:"testing"`
+	ServerErrorPValue float64  `json:"server_error_p_value"`
+	ClientErrorPValue float64  `json:"client_error_p_value"`
+}
+
+func total(classes [6]int64) (sum int64) {
+	for _, c := range classes {
+		sum += c
+	}
+	return
+}
+
+func share(classes [6]int64, class int) float64 {
+	sum := total(classes)
+	if sum == 0 {
+		return 0
+	}
+	return float64(classes[class]) / float64(sum)
+}
+
+// compareStatus only counts running routes that testing has seen, as testing only gets a copy of some methods.
+func compareStatus(in Input, serverErrorMargin, clientErrorMargin float64) (s StatusComparison) {
+	for route, testing := range in.TestingRoutes {
+		running := in.RunningRoutes[route]
+		for i := range s.Testing {
+			s.Testing[i] += testing.StatusClasses[i]
+			s.Running[i] += running.StatusClasses[i]
+		}
+	}
+	nt, nr := total(s.Testing), total(s.Running)
+	s.ServerErrorPValue = stats.UpperTailP(stats.TwoProportionZ(s.Testing[5], nt, s.Running[5], nr, serverErrorMargin))
+	more := stats.TwoProportionZ(s.Testing[4], nt, s.Running[4], nr, clientErrorMargin)
+	less := stats.TwoProportionZ(s.Running[4], nr, s.Testing[4], nt, clientErrorMargin)
+	s.ClientErrorPValue = math.Min(1, 2*stats.UpperTailP(math.Max(more, less))) //A change either way is flagged
+	return
+}
+
+func (s StatusComparison) String() string {
+	parts := make([]string, 0, 4)
+	for class := 2; class <= 5; class++ {
+		parts = append(parts, fmt.Sprintf("%dxx %.1f%%/%.1f%%", class, share(s.Testing, class)*100, share(s.Running, class)*100))
+	}
+	return strings.Join(parts, " ")
+}
@@ -3,15 +3,25 @@ package server
 import (
 	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/envlib"
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/fingerprint"
 	"github.com/cantara/vili/fs"
 	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/procstat"
+	"github.com/cantara/vili/quarantine"
+	"github.com/cantara/vili/schedule"
+	"github.com/cantara/vili/server/scorer"
 	"github.com/cantara/vili/server/servlet"
 	"github.com/cantara/vili/slack"
 	"github.com/cantara/vili/typelib"
@@ -25,6 +35,18 @@ const (
 	newService
 	restartServer
 	deployServer
+	abandonTesting
+	rollback
+	endWatch
+	restoreVersion
+	resetTest
+	pausePromotion
+	resumePromotion
+	startHeld
+	rolledOut
+	freezeServer
+	unfreezeServer
+	unquarantine
 )
 
 type commandData struct {
@@ -32,45 +54,163 @@ type commandData struct {
 	serverDir  fslib.Dir
 	command    commandType
 	serverType typelib.ServerType
+	replica    *replica
+	reason     string
+	force      bool
+	automatic  bool //Abandons decided by vili, not by hand, are held while frozen
+	result     *scorer.Result
+	err        error
+	finish     func(error) error
+	unarchive  func(version string, dst fslib.Dir) (fslib.Dir, error)
 	errorChan  chan error
 }
 
+// respond sends err to whoever waits for the command, commands sent by vili itself don't wait.
+func respond(errorChan chan error, err error) {
+	if errorChan != nil {
+		errorChan <- err
+	}
+}
+
+var ErrRollingOut = fmt.Errorf("Running is being replaced, try again when it is done")
+
 type server struct {
 	running        servletHandler
 	testing        servletHandler
+	previous       servletHandler //The version running replaced, kept while the promotion is watched
 	availablePorts *list.List
+	portsMutex     sync.Mutex
 	oldFolders     chan<- fslib.Dir
 	serverCommands chan commandData
 	dir            fslib.Dir
 	cancel         func()
+	replicas       int
+	hostname       string
+	newServlet     func(servletDir fslib.Dir, port string, t typelib.ServerType) (servlet.Servlet, error)
+
+	scorer               scorer.Scorer
+	minTestDuration      time.Duration
+	testWindow           time.Duration
+	maxStartupRegression float64
+	readyTimeout         time.Duration
+	minShadowRequests    int64
+	minRoutes            int
+	minMethodRequests    int64
+	stuckReported        time.Time
+	schedule             schedule.Schedule
+	waiting              bool //Testing passed and waits for a deploy window, guarded by the testing mutex
+	manualApproval       bool
+	awaitingApproval     bool //Guarded by the testing mutex
+	quarantine           *quarantine.Store
+	watchPeriod          time.Duration
+	watchScorer          scorer.Scorer
+	events               *eventlog.Log
+	maxTestWindows       int
+	maxTestTime          time.Duration
+	testStarted          time.Time //Guarded by the testing mutex like windows
+	windows              []string
+	windowEnded          time.Time //When the last window was counted, windows extended for lack of traffic keep their counters
+	paused               bool      //Guarded by the testing mutex
+	frozen               bool      //Frozen by hand, guarded by the testing mutex like the rest of the freeze
+	frozenByFile         bool      //Read from the FREEZE file by watchFreeze
+	wasFrozen            bool
+	heldVerdict          *commandData //Abandon of testing decided while frozen
+	heldVerdictDir       fslib.Dir
+	held                 fslib.Dir //The newest version found while frozen
+	frozenPassed         string    //Testing version reported as passed while frozen
+	started              time.Time
+	reportedFingerprints map[string]bool
+	fingerprintMutex     sync.Mutex
+	scores               []ScorePoint
+	mismatches           []Mismatch
+	samplesMutex         sync.Mutex
 }
 
 type servletHandler struct {
-	servlet    servlet.Servlet
+	replicas   []*replica
+	next       int
+	balancing  balancing
 	mesureFrom time.Time
 	mutex      sync.Mutex
 	isDying    bool
+	rolling    bool //Replicas are being replaced outside of the command watcher
 	serverType typelib.ServerType
 	dir        fslib.Dir
 }
 
-func Initialize(workingDir fslib.Dir, of chan<- fslib.Dir, portrangeFrom, portrangeTo int) (s *server, err error) {
+func Initialize(workingDir fslib.Dir, of chan<- fslib.Dir, portrangeFrom, portrangeTo int, events *eventlog.Log) (s *server, err error) {
 	fs.Initialize(workingDir)
+	replicas := envlib.Int("replicas", 1)
+	if replicas < 1 {
+		err = fmt.Errorf("Number of replicas needs to be atleast 1, got %d", replicas)
+		return
+	}
+	if portrangeTo-portrangeFrom+1 < replicas*2+2 { //Rolling replacement of running while testing needs a few extra ports
+		err = fmt.Errorf("Port range %d-%d is too small for %d replicas", portrangeFrom, portrangeTo, replicas)
+		return
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return
+	}
+	sc, err := scorer.FromEnv()
+	if err != nil {
+		return
+	}
+	sched, err := schedule.FromEnv()
+	if err != nil {
+		return
+	}
+	q, err := quarantine.Open(workingDir.Path() + "/quarantine.json")
+	if err != nil {
+		return
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	s = &server{
 		running: servletHandler{
 			serverType: typelib.RUNNING,
+			balancing:  balancingFromString(os.Getenv("load_balancing")),
 		},
 		testing: servletHandler{
 			serverType: typelib.TESTING,
 		},
+		previous: servletHandler{
+			serverType: typelib.PREVIOUS,
+		},
 		oldFolders:     of,
 		serverCommands: make(chan commandData, 5),
 		dir:            workingDir,
 		cancel:         cancel,
+		replicas:       replicas,
+		hostname:       hostname,
+		newServlet:     startServlet,
+
+		scorer:               sc,
+		minTestDuration:      envlib.Duration("min_test_duration", time.Minute*5),
+		testWindow:           envlib.Duration("test_window", time.Minute*15),
+		maxStartupRegression: envlib.Float("max_startup_regression", 2),
+		readyTimeout:         envlib.Duration("ready_timeout", time.Minute*5),
+		minShadowRequests:    int64(envlib.Int("min_shadow_requests", 200)),
+		minRoutes:            envlib.Int("min_routes", 3),
+		minMethodRequests:    int64(envlib.Int("min_method_requests", 0)),
+		schedule:             sched,
+		manualApproval:       strings.ToLower(os.Getenv("promotion_policy")) == "manual",
+		quarantine:           q,
+		events:               events,
+		maxTestWindows:       envlib.Int("max_test_windows", 8),
+		maxTestTime:          envlib.Duration("max_test_time", 0),
+		started:              time.Now(),
+		watchPeriod:          envlib.Duration("watch_period", time.Minute*30),
+		watchScorer:          scorer.RatesFromEnv(), //Only rejections are used, so the watch is judged on rates whatever scorer decides promotion
+		reportedFingerprints: make(map[string]bool),
 	}
 	s.setAvailablePorts(portrangeFrom, portrangeTo)
+	s.frozenByFile = s.freezeFileExists()
+	s.wasFrozen = s.frozenByFile
 	go s.newServerWatcher(ctx)
+	go s.watchFreeze(ctx)
+	go s.sampleScores(ctx)
+	s.registerMetrics()
 	err = s.startExcistingRunning()
 	if err != nil {
 		return
@@ -80,7 +220,7 @@ func Initialize(workingDir fslib.Dir, of chan<- fslib.Dir, portrangeFrom, portra
 }
 
 func (s *server) startExcistingRunning() (err error) {
-	firstServerDir, err := fs.GetFirstServerDir(typelib.RUNNING)
+	firstServerDir, err := fs.GetFirstServerDir(typelib.RUNNING, s.quarantine.Contains)
 	if err != nil {
 		log.AddError(err).Debug("Finding first running server dir")
 		return
@@ -96,7 +236,7 @@ func (s *server) startExcistingRunning() (err error) {
 
 func (s *server) startExcistingTesting() (err error) {
 	log.Debug("Trying to find existing testing")
-	firstTestServerDir, err := fs.GetFirstServerDir(typelib.TESTING)
+	firstTestServerDir, err := fs.GetFirstServerDir(typelib.TESTING, s.quarantine.Contains)
 	if err != nil {
 		log.AddError(err).Debug("Finding first testing server dir")
 		return
@@ -121,78 +261,197 @@ func (s *server) newServerWatcher(ctx context.Context) {
 			log.Info("New command recieved")
 			switch command.command {
 			case newServer: //New servers are always testing
+				if s.Quarantined(stripJar(command.server)) {
+					command.errorChan <- ErrQuarantined
+					continue
+				}
 				serverDir, err := fs.CreateNewServerStructure(command.server)
 				if err != nil {
 					log.AddError(err).Error("Creatubg new server structure")
 					command.errorChan <- err
 					continue
 				}
-				var oldFolder fslib.Dir
-				if s.testing.servlet != nil {
-					oldFolder = s.testing.dir
-				}
-				if oldFolder != nil {
-					s.oldFolders <- oldFolder
+				s.events.Add(eventlog.Event{Type: eventlog.STRUCTURE_CREATED, Version: serverDir.File().Name(), Message: serverDir.Path()})
+				if s.Frozen() {
+					s.hold(serverDir)
+					command.errorChan <- ErrFrozen
+					continue
 				}
-				command.errorChan <- s.startServiceFromWatcher(serverDir, typelib.TESTING)
+				s.replaceTesting()
+				command.errorChan <- s.startServiceFromWatcher(serverDir, typelib.TESTING, nil)
+			case startHeld:
+				command.errorChan <- s.startHeld()
 			case startServer:
-				command.errorChan <- s.startServiceFromWatcher(command.serverDir, command.serverType)
+				if command.serverType != typelib.RUNNING {
+					command.errorChan <- s.startServiceFromWatcher(command.serverDir, command.serverType, nil)
+					continue
+				}
+				if s.running.isRolling() {
+					command.errorChan <- ErrRollingOut
+					continue
+				}
+				s.rollOut(command.serverDir, nil, command.errorChan, func(err error) error { return err })
 			case restartServer:
 				log.Info("RESTARTING ", command.serverType)
-				var err error
-				switch command.serverType {
-				case typelib.RUNNING:
-					/*
-						s.running.mutex.Lock()
-						if s.running.isDying {
-							s.running.mutex.Unlock()
-							continue
-						}
-						s.running.isDying = true
-						s.running.mutex.Unlock()
-					*/
-					command.errorChan <- s.startServiceFromWatcher(s.running.dir, command.serverType)
-				case typelib.TESTING:
-					/*
-						s.testing.mutex.Lock()
-						if s.testing.isDying || s.testing.servlet == nil {
-							s.testing.mutex.Unlock()
-							continue
-						}
-						s.testing.isDying = true
-						s.testing.mutex.Unlock()
-					*/
-					command.errorChan <- s.startServiceFromWatcher(s.testing.dir, command.serverType)
+				restart := command
+				switch {
+				case command.serverType == typelib.RUNNING && s.running.isRolling():
+					if command.replica != nil { //Stopped replicas are restarted when the rollout is done
+						continue
+					}
+					respond(command.errorChan, ErrRollingOut)
+				case command.replica != nil:
+					s.rollRestart(restart)
+				case s.handler(command.serverType).dir == nil:
+					err := fmt.Errorf("No %s version to restart", command.serverType)
+					respond(command.errorChan, err)
+					s.restarted(restart, err)
+				case command.serverType == typelib.RUNNING:
+					s.rollOut(s.running.dir, nil, command.errorChan, func(err error) error {
+						s.restarted(restart, err)
+						return err
+					})
+				default:
+					err := s.startServiceFromWatcher(s.handler(command.serverType).dir, command.serverType, nil)
+					respond(command.errorChan, err)
+					s.restarted(restart, err)
 				}
-				if err != nil {
-					log.AddError(err).Error("Restarting server ", command.serverType)
-					go slack.Sendf(" :recycle: :x: Vili failed to restart servlet on host: %s, version %s.", "<tmp unavailable>", s.GetRunningVersion())
-				} else {
-					go slack.Sendf(" :recycle: Vili restarted servlet on host: %s, version %s.", "<tmp unavailable>", s.GetRunningVersion())
+			case rolledOut:
+				s.running.mutex.Lock()
+				s.running.rolling = false
+				s.running.mutex.Unlock()
+				respond(command.errorChan, command.finish(command.err))
+				s.restartStopped()
+			case resetTest:
+				if !s.HasTesting() {
+					command.errorChan <- ErrNoTesting
+					continue
 				}
+				s.resetTest()
+				s.testResetEvent("by hand", nil)
+				command.errorChan <- nil
+			case pausePromotion, resumePromotion:
+				s.testing.mutex.Lock()
+				s.paused = command.command == pausePromotion
+				s.testing.mutex.Unlock()
+				log.Info("Automatic promotion paused: ", command.command == pausePromotion)
+				command.errorChan <- nil
 			case deployServer:
 				log.Info("DEPLOYING NEW RUNNING SERVER")
+				if err := s.deployBlocked(); err != nil {
+					s.testing.mutex.Lock()
+					s.testing.isDying = false //Testing stays so it can be promoted later
+					s.testing.mutex.Unlock()
+					command.errorChan <- err
+					continue
+				}
 				s.testing.mutex.Lock()
-				if s.testing.servlet == nil {
+				if len(s.testing.replicas) == 0 {
 					log.Info("Nothing to deploy")
 					s.testing.mutex.Unlock()
 					command.errorChan <- nil
-					return
+					continue
 				}
 				serverDir := s.testing.dir
-				s.testing.servlet.Kill()
-				s.availablePorts.PushFront(s.testing.servlet.Port())
-				s.testing.servlet = nil
+				testers := s.testing.replicas
+				s.testing.replicas = nil
+				s.waiting = false
+				s.awaitingApproval = false
 				s.testing.mutex.Unlock()
+				for _, r := range testers {
+					s.retire(r)
+				}
 
+				s.endWatch() //Only the version just replaced is watched
 				oldFolder := s.running.dir
-				err := s.startServiceFromWatcher(serverDir, typelib.RUNNING)
-				if err != nil {
-					log.AddError(err).Error("New server deployment")
-					command.errorChan <- err
+				var kept *replica
+				if s.watchPeriod > 0 {
+					s.running.mutex.Lock()
+					if n := len(s.running.replicas); n > 0 {
+						kept = s.running.replicas[n-1]
+					}
+					s.running.mutex.Unlock()
+				}
+				s.rollOut(serverDir, kept, command.errorChan, func(err error) error { //Replaces running replicas one by one so there is allways one serving
+					if err != nil {
+						log.AddError(err).Error("New server deployment")
+						s.testing.mutex.Lock()
+						current := samePath(s.testing.dir, serverDir)
+						if current {
+							s.testing.dir = nil
+						}
+						s.testing.mutex.Unlock()
+						if current { //A newer testing version has its own link
+							s.removeTestingLink()
+						}
+						s.abandoned(serverDir, fmt.Sprintf("promotion failed, %v", err), nil)
+						return err
+					}
+					s.record(eventlog.PROMOTED, serverDir, oldFolder, "")
+					deploysTotal.Inc()
+					if kept != nil {
+						s.startWatch(kept, oldFolder)
+					} else {
+						s.archive(oldFolder)
+					}
+					return nil
+				})
+			case freezeServer, unfreezeServer:
+				s.testing.mutex.Lock()
+				s.frozen = command.command == freezeServer
+				s.testing.mutex.Unlock()
+				s.updateFreeze()
+				if command.command == unfreezeServer && s.Frozen() {
+					command.errorChan <- fmt.Errorf("The %s file in %s keeps vili frozen", freezeFile, s.dir.Path())
+					continue
 				}
-				s.oldFolders <- oldFolder
 				command.errorChan <- nil
+			case abandonTesting:
+				if command.automatic && s.Frozen() {
+					s.holdVerdict(command)
+					respond(command.errorChan, ErrFrozen)
+					continue
+				}
+				s.testing.mutex.Lock()
+				if command.replica != nil && !s.testing.contains(command.replica) {
+					s.testing.mutex.Unlock()
+					log.Debug("Abandon request for a replica that is no longer testing")
+					if command.errorChan != nil {
+						command.errorChan <- nil
+					}
+					continue
+				}
+				respond(command.errorChan, s.abandonTesting(command.reason, command.result))
+			case rollback:
+				switch {
+				case s.Frozen():
+					respond(command.errorChan, ErrFrozen)
+				case s.running.isRolling():
+					respond(command.errorChan, ErrRollingOut)
+				default:
+					s.rollback(command.serverDir, command.reason, command.errorChan)
+				}
+			case restoreVersion:
+				switch {
+				case s.Frozen():
+					command.errorChan <- ErrFrozen
+				case command.force && s.running.isRolling():
+					command.errorChan <- ErrRollingOut
+				default:
+					serverDir, err := s.versionDir(command.server, command.unarchive)
+					if err != nil {
+						command.errorChan <- err
+						continue
+					}
+					s.restore(serverDir, command.force, command.errorChan)
+				}
+			case unquarantine:
+				respond(command.errorChan, s.unquarantine(command.server))
+			case endWatch:
+				if s.watching(command.serverDir) {
+					s.endWatch()
+					go slack.Sendf(" :white_check_mark: Vili ended the watch of version %s on host: %s, version %s is archived.", s.GetRunningVersion(), s.hostname, command.serverDir.File().Name())
+				}
 			}
 		case <-ctx.Done():
 			return
@@ -200,58 +459,366 @@ func (s *server) newServerWatcher(ctx context.Context) {
 	}
 }
 
-func (s *server) startServiceFromWatcher(serverDir fslib.Dir, t typelib.ServerType) (err error) {
+// startServiceFromWatcher replaces the replicas of t one by one, keep is taken out of t without being retired.
+// When a replica fails to start the replicas it replaced are brought back, so t does not run mixed versions.
+func (s *server) startServiceFromWatcher(serverDir fslib.Dir, t typelib.ServerType, keep *replica) (err error) {
 	log.Debug("Starting new server")
+	h := s.handler(t)
+	h.mutex.Lock()
+	oldDir := h.dir
+	var oldReplicas []*replica
+	for _, r := range h.replicas {
+		if r != keep {
+			oldReplicas = append(oldReplicas, r)
+		}
+	}
+	h.mutex.Unlock()
+
+	numReplicas := s.numReplicas(t)
+	started, err := s.replaceReplicas(serverDir, t, oldReplicas, numReplicas)
+	if err != nil {
+		if len(started) == 0 || oldDir == nil {
+			return
+		}
+		log.AddError(err).Warning("Only started ", len(started), " of ", numReplicas, " replicas of ", serverDir.File().Name(), ", bringing back ", oldDir.File().Name())
+		_, restoreErr := s.replaceReplicas(oldDir, t, started, len(started))
+		if restoreErr != nil {
+			log.AddError(restoreErr).Error("While bringing back ", t, " replicas of ", oldDir.File().Name())
+			go slack.Sendf(" :sos: Vili failed to start %s version %s on host: %s and could not bring back all replicas of %s, %s is running mixed versions.", t, serverDir.File().Name(), s.hostname, oldDir.File().Name(), t)
+		}
+		return
+	}
+	if keep != nil {
+		h.mutex.Lock()
+		h.remove(keep)
+		h.mutex.Unlock()
+	}
+
+	log.Debug("Starting to symlink folders")
+	err = serverDir.Symlink(serverDir.File(), fmt.Sprintf("%s-%s", os.Getenv("identifier"), t.String()))
+	log.Debug("Finished to symlink folders")
+	if t == typelib.TESTING {
+		s.testing.mutex.Lock()
+		s.testStarted = time.Now()
+		s.windows = nil
+		s.windowEnded = time.Time{}
+		s.testing.mutex.Unlock()
+	}
+	log.Debug("Restarting tests")
+	s.resetTest()
+	return nil
+}
+
+// replaceReplicas starts n replicas of serverDir, each taking the place of one of old. Running replicas only get traffic once they are ready.
+func (s *server) replaceReplicas(serverDir fslib.Dir, t typelib.ServerType, old []*replica, n int) (started []*replica, err error) {
+	h := s.handler(t)
+	for i := 0; i < n; i++ {
+		var rep *replica
+		rep, err = s.startReplica(serverDir, t)
+		if err != nil {
+			return
+		}
+		if t == typelib.RUNNING {
+			err = s.waitReady(rep)
+			if err != nil {
+				s.retire(rep)
+				return
+			}
+		}
+
+		log.Debug("Adding servlet to server structure")
+		var retired *replica
+		h.mutex.Lock()
+		h.replicas = append(h.replicas, rep)
+		h.dir = serverDir
+		h.isDying = false
+		if len(old) > 0 {
+			retired, old = old[0], old[1:]
+			h.remove(retired)
+		}
+		h.mutex.Unlock()
+		started = append(started, rep)
+		if retired != nil {
+			log.Debug("Killing old server")
+			s.retire(retired)
+		}
+	}
+	for _, retired := range old {
+		h.mutex.Lock()
+		h.remove(retired)
+		h.mutex.Unlock()
+		s.retire(retired)
+	}
+	return
+}
+
+// rollOut replaces the running replicas outside of the command watcher, since waiting for them to be ready can take minutes.
+// finish is run on the command watcher when it is done and what it returns is sent on errorChan.
+func (s *server) rollOut(serverDir fslib.Dir, keep *replica, errorChan chan error, finish func(error) error) {
+	s.roll(func() error { return s.startServiceFromWatcher(serverDir, typelib.RUNNING, keep) }, errorChan, finish)
+}
+
+// roll runs start outside of the command watcher while running is marked as rolling, like rollOut.
+func (s *server) roll(start func() error, errorChan chan error, finish func(error) error) {
+	s.running.mutex.Lock()
+	s.running.rolling = true
+	s.running.mutex.Unlock()
+	go func() {
+		s.serverCommands <- commandData{command: rolledOut, err: start(), finish: finish, errorChan: errorChan}
+	}()
+}
+
+func (s *server) deployBlocked() error {
+	if s.Frozen() {
+		return ErrFrozen
+	}
+	if s.running.isRolling() {
+		return ErrRollingOut
+	}
+	return nil
+}
+
+func (h *servletHandler) isRolling() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.rolling
+}
+
+// restartStopped restarts a running replica that stopped during a rollout, it is run from the command watcher.
+// The next one is restarted when that restart has rolled out.
+func (s *server) restartStopped() {
+	s.running.mutex.Lock()
+	var stopped *replica
+	for _, r := range s.running.replicas {
+		if !r.IsRunning() && !r.isRetired() {
+			stopped = r
+			break
+		}
+	}
+	s.running.mutex.Unlock()
+	if stopped != nil {
+		s.rollRestart(commandData{serverType: typelib.RUNNING, replica: stopped})
+	}
+}
+
+// rollRestart replaces a stopped replica outside of the command watcher, as the new one has to be ready before it gets traffic.
+func (s *server) rollRestart(restart commandData) {
+	s.roll(func() error { return s.restartReplica(restart.replica) }, restart.errorChan, func(err error) error {
+		if errors.Is(err, errReplicaGone) {
+			return nil
+		}
+		s.restarted(restart, err)
+		return err
+	})
+}
+
+// restarted reports how a restart went.
+func (s *server) restarted(command commandData, err error) {
+	version := s.GetRunningVersion()
+	if command.serverType == typelib.TESTING {
+		version = s.GetTestingVersion()
+	}
+	if err != nil {
+		log.AddError(err).Error("Restarting server ", command.serverType)
+		go slack.Sendf(" :recycle: :x: Vili failed to restart %s servlet on host: %s, version %s.", command.serverType, s.hostname, version)
+		return
+	}
+	restartsTotal.Inc(command.serverType.String())
+	reason := "by hand"
+	if command.replica != nil {
+		reason = "replica on port " + command.replica.Port() + " stopped"
+	}
+	if dir := s.handler(command.serverType).dir; dir != nil {
+		s.record(eventlog.RESTARTED, dir, nil, fmt.Sprintf("%s %s", command.serverType, reason))
+	}
+	go slack.Sendf(" :recycle: Vili restarted %s servlet on host: %s, version %s.", command.serverType, s.hostname, version)
+}
+
+func (s *server) startReplica(serverDir fslib.Dir, t typelib.ServerType) (rep *replica, err error) {
 	port := s.getAvailablePort()
 	servletDir, err := fs.CreateNewServerInstanceStructure(serverDir, t, port)
 	if err != nil {
 		log.AddError(err).Error("While creating servlet dir")
-		s.availablePorts.PushFront(port)
-		return err
+		s.releasePort(port)
+		return
 	}
 	log.Debug("Servlet dir created")
 
 	log.Debug("Starting servlet")
-	serv, err := servlet.NewServlet(servletDir, port)
+	serv, err := s.newServlet(servletDir, port, t)
 	if err != nil {
 		log.AddError(err).Error("While creating new servlet")
-		s.availablePorts.PushFront(port)
-		return err
+		s.releasePort(port)
+		return
 	}
 	log.Debug("Started servlet")
+	rep = &replica{
+		Servlet:    serv,
+		serverType: t,
+		version:    serverDir.File().Name(),
+	}
+	s.servletEvent(eventlog.SERVLET_STARTED, rep, "")
+	go s.watchLifecycle(rep)
+	if t == typelib.RUNNING {
+		go s.watchServerStatus(rep)
+	} else {
+		go s.watchServletFailure(rep)
+	}
+	return
+}
+
+// startServlet starts the java process of a replica.
+func startServlet(servletDir fslib.Dir, port string, t typelib.ServerType) (servlet.Servlet, error) {
+	serv, err := servlet.NewServlet(servletDir, port, t)
+	if err != nil {
+		return nil, err
+	}
+	return serv, nil
+}
+
+var errReplicaGone = fmt.Errorf("Replica is no longer in use")
+
+func (s *server) restartReplica(old *replica) (err error) {
+	h := s.handler(old.serverType)
+	h.mutex.Lock()
+	serverDir := h.dir
+	inUse := h.contains(old)
+	h.mutex.Unlock()
+	if !inUse {
+		log.Debug("Replica is no longer in use, not restarting")
+		return errReplicaGone
+	}
+	rep, err := s.startReplica(serverDir, old.serverType)
+	if err != nil {
+		return
+	}
+	if old.serverType == typelib.RUNNING {
+		err = s.waitReady(rep)
+		if err != nil {
+			s.retire(rep)
+			return
+		}
+	}
+	h.mutex.Lock()
+	h.remove(old)
+	h.replicas = append(h.replicas, rep)
+	h.mutex.Unlock()
+	s.retire(old)
+	return
+}
+
+// abandonTesting expects the testing mutex to be held and releases it. The abandoned version is quarantined.
+func (s *server) abandonTesting(reason string, result *scorer.Result) error {
+	if len(s.testing.replicas) == 0 {
+		s.testing.mutex.Unlock()
+		return fmt.Errorf("No testing version to abandon")
+	}
+	serverDir := s.testing.dir
+	testers := s.testing.replicas
+	s.testing.replicas = nil
+	s.testing.dir = nil
+	s.testing.isDying = false
+	s.waiting = false
+	s.awaitingApproval = false
+	s.testing.mutex.Unlock()
+	log.Warning("Abandoning testing version ", serverDir.File().Name(), ": ", reason)
+	for _, r := range testers {
+		s.retire(r)
+	}
+	s.removeTestingLink()
+	s.abandoned(serverDir, reason, result)
+	return nil
+}
+
+// removeTestingLink is done when a version is abandoned, so it is not picked up again on startup.
+func (s *server) removeTestingLink() {
+	s.dir.Remove(fmt.Sprintf("%s-%s", os.Getenv("identifier"), typelib.TESTING))
+}
+
+// abandoned quarantines and archives a version whose testers are gone.
+func (s *server) abandoned(serverDir fslib.Dir, reason string, result *scorer.Result) {
+	s.record(eventlog.ABANDONED, serverDir, nil, reason)
+	abandonedTotal.Inc()
+	s.quarantineVersion(serverDir, reason, result)
+	s.archive(serverDir)
+	go slack.Sendf(" :x: Vili abandoned testing version %s on host: %s, running version is still %s. Reason: %s.", serverDir.File().Name(), s.hostname, s.GetRunningVersion(), reason)
+}
+
+func (s *server) watchServletFailure(r *replica) {
+	ready := r.Ready()
+	for {
+		select {
+		case <-ready:
+			ready = nil
+			if reason := s.startupRegression(r.StartupTime()); reason != "" {
+				s.serverCommands <- commandData{command: abandonTesting, replica: r, reason: reason, automatic: true}
+				return
+			}
+		case reason := <-r.Failed():
+			s.serverCommands <- commandData{command: abandonTesting, replica: r, reason: reason, automatic: true}
+			return
+		case <-r.Exited():
+			return
+		}
+	}
+}
+
+const startupRegressionSlack = time.Second * 5
+
+func (s *server) startupRegression(startup time.Duration) string {
+	running := s.running.startupTime()
+	if running == 0 {
+		return ""
+	}
+	if startup <= time.Duration(float64(running)*s.maxStartupRegression) || startup-running < startupRegressionSlack {
+		return ""
+	}
+	return fmt.Sprintf("startup took %s while running started in %s", startup.Round(time.Second), running.Round(time.Second))
+}
+
+// waitReady lets a new replica become ready before it takes the place of the replica it replaces.
+func (s *server) waitReady(r *replica) error {
+	select {
+	case <-r.Ready():
+		return nil
+	case <-r.Exited():
+		return fmt.Errorf("Replica on port %s stopped before it was ready", r.Port())
+	case <-time.After(s.readyTimeout):
+		return fmt.Errorf("Replica on port %s was not ready within %s", r.Port(), s.readyTimeout)
+	}
+}
 
-	log.Debug("Adding servlet to server structure")
-	var oldServer servlet.Servlet
+func (s *server) retire(r *replica) {
+	if r.markRetired() {
+		s.servletEvent(eventlog.SERVLET_KILLED, r, "retired")
+	}
+	r.Kill()
+	s.releasePort(r.Port())
+}
+
+func (s *server) handler(t typelib.ServerType) *servletHandler {
 	switch t {
-	case typelib.RUNNING:
-		s.running.mutex.Lock()
-		oldServer, s.running.servlet = s.running.servlet, serv
-		s.running.dir = serverDir
-		s.running.isDying = false
-		s.running.mutex.Unlock()
 	case typelib.TESTING:
-		s.testing.mutex.Lock()
-		oldServer, s.testing.servlet = s.testing.servlet, serv
-		s.testing.dir = serverDir
-		s.testing.isDying = false
-		s.testing.mutex.Unlock()
+		return &s.testing
+	case typelib.PREVIOUS:
+		return &s.previous
 	}
-	log.Debug("Done servlet to server structure")
+	return &s.running
+}
 
-	log.Debug("Starting to symlink folders")
-	err = serverDir.Symlink(serverDir.File(), fmt.Sprintf("%s-%s", os.Getenv("identifier"), t.String()))
-	if oldServer != nil {
-		log.Debug("Killing old server")
-		oldServer.Kill()
-		s.availablePorts.PushFront(oldServer.Port())
+func (s *server) numReplicas(t typelib.ServerType) int {
+	if t == typelib.TESTING {
+		return 1
 	}
-	log.Debug("Finished to symlink folders")
-	log.Debug("Restarting tests")
-	s.ResetTest()
-	if t == typelib.RUNNING {
-		go s.watchServerStatus(t, serv)
+	return s.replicas
+}
+
+func (s *server) Acquire(t typelib.ServerType) (Upstream, error) {
+	r, err := s.handler(t).pick()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return r, nil
 }
 
 func (s *server) NewTesting(server string) error {
@@ -261,19 +828,52 @@ func (s *server) NewTesting(server string) error {
 	return <-errorChan
 }
 
-func (s *server) Deploy() error {
+var ErrOutsideDeployWindow = fmt.Errorf("Outside of deploy window")
+
+// Deploy promotes testing when the schedule allows it. Otherwise testing is queued for the next deploy window when wait is set,
+// and ErrOutsideDeployWindow is returned when it is not.
+func (s *server) Deploy(wait bool) (queued bool, err error) {
+	if s.Frozen() {
+		return false, ErrFrozen
+	}
+	if !s.schedule.Allowed(time.Now()) {
+		if !wait {
+			return false, ErrOutsideDeployWindow
+		}
+		s.awaitWindow("manual deploy")
+		return true, nil
+	}
+	return false, s.deploy()
+}
+
+func (s *server) deploy() error {
 	errorChan := make(chan error, 1)
 	defer close(errorChan)
 	s.serverCommands <- commandData{command: deployServer, errorChan: errorChan}
 	return <-errorChan
 }
 
-func (s *server) RestartRunning() {
-	//s.serverCommands <- commandData{command: restartServer, serverType: typelib.RUNNING}
+func (s *server) AbandonTesting(reason string) error {
+	errorChan := make(chan error, 1)
+	defer close(errorChan)
+	s.serverCommands <- commandData{command: abandonTesting, reason: reason, errorChan: errorChan}
+	return <-errorChan
 }
 
-func (s *server) RestartTesting() {
-	//s.serverCommands <- commandData{command: restartServer, serverType: typelib.TESTING}
+func (s *server) RestartRunning() error {
+	return s.command(commandData{command: restartServer, serverType: typelib.RUNNING})
+}
+
+func (s *server) RestartTesting() error {
+	return s.command(commandData{command: restartServer, serverType: typelib.TESTING})
+}
+
+// command sends c to the command watcher and waits for it to be handled.
+func (s *server) command(c commandData) error {
+	c.errorChan = make(chan error, 1)
+	defer close(c.errorChan)
+	s.serverCommands <- c
+	return <-c.errorChan
 }
 
 func (s *server) newVersion(server string, t typelib.ServerType) {
@@ -287,19 +887,152 @@ func (s *server) startService(serverDir fslib.Dir, t typelib.ServerType) error {
 	return <-errorChan
 }
 
-func (s server) ReliabilityScore() (int64, error) {
-	if s.TestingDuration() < time.Minute*5 {
-		return 0, fmt.Errorf("Testduration does not exceed minimum test time")
+func (s *server) ReliabilityScore() (r scorer.Result, err error) {
+	duration := s.TestingDuration()
+	if duration < s.minTestDuration {
+		err = fmt.Errorf("Testduration does not exceed minimum test time")
+		return
 	}
-	return s.running.servlet.ReliabilityScore() - s.testing.servlet.ReliabilityScore(), nil
+	r = s.scorer.Score(scorer.Input{
+		Running:          s.running.counters(),
+		Testing:          s.testing.counters(),
+		RunningRoutes:    s.running.routes(),
+		TestingRoutes:    s.testing.routes(),
+		RunningWarmup:    s.running.warmupCounters(),
+		TestingWarmup:    s.testing.warmupCounters(),
+		RunningResources: s.running.resources(),
+		TestingResources: s.testing.resources(),
+		NewFingerprints:  len(s.NewFingerprints()),
+		Duration:         duration,
+	})
+	return
 }
 
-func (s *server) watchServerStatus(t typelib.ServerType, serv servlet.Servlet) {
-	serv.Wait()
-	switch t {
+func (h *servletHandler) fingerprints() map[string]fingerprint.Fingerprint {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	out := make(map[string]fingerprint.Fingerprint)
+	for _, r := range h.replicas {
+		for id, fp := range r.Fingerprints() {
+			if known, ok := out[id]; ok {
+				fp.Count += known.Count
+			}
+			out[id] = fp
+		}
+	}
+	return out
+}
+
+func (s *server) NewFingerprints() (fps []fingerprint.Fingerprint) {
+	running := s.running.fingerprints()
+	for id, fp := range s.testing.fingerprints() {
+		if _, ok := running[id]; ok {
+			continue
+		}
+		fps = append(fps, fp)
+	}
+	sort.Slice(fps, func(i, j int) bool {
+		return fps[i].FirstSeen.Before(fps[j].FirstSeen)
+	})
+	return
+}
+
+func (s *server) reportNewFingerprints(hostname string) {
+	for _, fp := range s.NewFingerprints() {
+		s.fingerprintMutex.Lock()
+		reported := s.reportedFingerprints[fp.Id]
+		s.reportedFingerprints[fp.Id] = true
+		s.fingerprintMutex.Unlock()
+		if reported {
+			continue
+		}
+		go slack.Sendf(" :beetle: Vili found a new exception type in testing version %s on host: %s, %s [%s] at %s.",
+			s.GetTestingVersion(), hostname, fp.Type, fp.Id, strings.Join(fp.Frames, " < "))
+	}
+}
+
+func fingerprintSummary(fps []fingerprint.Fingerprint) string {
+	if len(fps) == 0 {
+		return "no new exception types"
+	}
+	summary := make([]string, len(fps))
+	for i, fp := range fps {
+		summary[i] = fmt.Sprintf("%s [%s] x%d", fp.Type, fp.Id, fp.Count)
+	}
+	return fmt.Sprintf("%d new exception types: %s", len(fps), strings.Join(summary, ", "))
+}
+
+func (h *servletHandler) routes() map[string]typelib.RouteCounters {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	out := make(map[string]typelib.RouteCounters)
+	for _, r := range h.replicas {
+		for route, c := range r.Routes() {
+			out[route] = out[route].Add(c)
+		}
+	}
+	return out
+}
+
+// warmupCounters is per replica, so running with many replicas compares to a single tester.
+func (h *servletHandler) warmupCounters() (c typelib.Counters) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.replicas) == 0 {
+		return
+	}
+	for _, r := range h.replicas {
+		c = c.Add(r.WarmupCounters())
+	}
+	n := int64(len(h.replicas))
+	return typelib.Counters{
+		Requests: c.Requests / n,
+		Breaking: c.Breaking / n,
+		Errors:   c.Errors / n,
+		Warnings: c.Warnings / n,
+		Weight:   c.Weight / n,
+	}
+}
+
+func (h *servletHandler) startupTime() (startup time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, r := range h.replicas {
+		if r.StartupTime() > startup {
+			startup = r.StartupTime()
+		}
+	}
+	return
+}
+
+func (h *servletHandler) resources() procstat.Summary {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	summaries := make([]procstat.Summary, 0, len(h.replicas))
+	for _, r := range h.replicas {
+		summaries = append(summaries, procstat.Summarize(r.Resources(h.mesureFrom)))
+	}
+	return procstat.Mean(summaries) //Replicas are compared per process
+}
+
+func (h *servletHandler) counters() (c typelib.Counters) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, r := range h.replicas {
+		c = c.Add(r.Counters())
+	}
+	return
+}
+
+func (s *server) watchServerStatus(r *replica) {
+	r.Wait()
+	if r.isRetired() {
+		return
+	}
+	switch r.serverType {
 	case typelib.RUNNING:
 		//s.RestartRunning()
-		s.serverCommands <- commandData{command: restartServer, serverType: typelib.RUNNING}
+		s.serverCommands <- commandData{command: restartServer, serverType: typelib.RUNNING, replica: r}
 	case typelib.TESTING:
 		s.RestartTesting()
 	}
@@ -325,14 +1058,14 @@ func (s *server) watchServerStatus(t typelib.ServerType, serv servlet.Servlet) {
 	*/
 }
 
-func (s server) GetRunningVersion() string {
+func (s *server) GetRunningVersion() string {
 	if s.running.dir == nil {
 		return "unknown"
 	}
 	return s.running.dir.File().Name()
 }
 
-func (s server) GetTestingVersion() string {
+func (s *server) GetTestingVersion() string {
 	if !s.IsTestingRunning() {
 		return "none"
 	}
@@ -342,70 +1075,94 @@ func (s server) GetTestingVersion() string {
 	return s.testing.dir.File().Name()
 }
 
-func (s server) GetPortRunning() string {
-	return s.running.servlet.Port()
-}
-
-func (s server) GetPortTesting() string {
-	return s.testing.servlet.Port()
-}
-
-func (s *server) AddBreaking() {
-	s.testing.servlet.IncrementBreaking()
-}
-
-func (s *server) AddRequestRunning() {
-	s.running.servlet.IncrementRequests()
-}
-
-func (s *server) AddRequestTesting() {
-	s.testing.servlet.IncrementRequests()
+func (s *server) AddBreaking(route string) {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	if len(s.testing.replicas) == 0 {
+		return
+	}
+	s.testing.replicas[0].IncrementBreaking(route)
 }
 
 func (s *server) HasTesting() bool {
 	s.testing.mutex.Lock()
 	defer s.testing.mutex.Unlock()
-	return s.testing.servlet != nil
+	return len(s.testing.replicas) > 0
 }
 
 func (s *server) TestingDuration() time.Duration {
 	s.testing.mutex.Lock()
 	defer s.testing.mutex.Unlock()
-	if s.testing.servlet == nil {
+	if len(s.testing.replicas) == 0 {
 		return time.Duration(0)
 	}
 	return time.Now().Sub(s.testing.mesureFrom)
 }
 
 func (s *server) Messuring() bool {
-	if s.testing.servlet == nil {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	if len(s.testing.replicas) == 0 {
 		return false
 	}
+	return !s.testing.mesureFrom.IsZero()
+}
+
+func (s *server) ResetTest() error {
+	return s.command(commandData{command: resetTest})
+}
+
+func (s *server) PausePromotion() error {
+	return s.command(commandData{command: pausePromotion})
+}
+
+func (s *server) ResumePromotion() error {
+	return s.command(commandData{command: resumePromotion})
+}
+
+func (s *server) promotionPaused() bool {
 	s.testing.mutex.Lock()
 	defer s.testing.mutex.Unlock()
-	return !s.testing.mesureFrom.IsZero()
+	return s.paused
 }
 
-func (s *server) ResetTest() { //TODO: Make better
+func (s *server) resetTest() { //TODO: Make better
 	if !s.HasTesting() {
 		return
 	}
-	s.testing.mutex.Lock()
-	s.testing.mesureFrom = time.Now()
-	s.testing.servlet.ResetTestData()
-	s.testing.mutex.Unlock()
-	s.running.mutex.Lock()
-	s.running.mesureFrom = time.Now()
-	s.running.servlet.ResetTestData()
-	s.running.mutex.Unlock()
+	s.testing.resetTestData()
+	s.running.resetTestData()
+}
+
+func (h *servletHandler) resetTestData() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.mesureFrom = time.Now()
+	for _, r := range h.replicas {
+		r.ResetTestData()
+	}
 }
 
-func (s server) getAvailablePort() string {
+func (s *server) getAvailablePort() string {
+	s.portsMutex.Lock()
+	defer s.portsMutex.Unlock()
 	port := s.availablePorts.Front()
 	s.availablePorts.Remove(port)
 	return port.Value.(string)
 }
 
+func (s *server) releasePort(port string) {
+	s.portsMutex.Lock()
+	defer s.portsMutex.Unlock()
+	s.availablePorts.PushFront(port)
+}
+
+func (s *server) availablePortCount() int {
+	s.portsMutex.Lock()
+	defer s.portsMutex.Unlock()
+	return s.availablePorts.Len()
+}
+
 func (s *server) setAvailablePorts(from, to int) {
 	if s.availablePorts != nil {
 		return
@@ -416,52 +1173,152 @@ func (s *server) setAvailablePorts(from, to int) {
 	}
 }
 
-func (s server) IsRunningRunning() bool {
-	return s.running.servlet.IsRunning()
+func (s *server) IsRunningRunning() bool {
+	return s.running.isRunning()
 }
 
-func (s server) IsTestingRunning() bool {
-	if s.testing.servlet == nil {
-		return false
+func (s *server) IsTestingRunning() bool {
+	return s.testing.isRunning()
+}
+
+func (h *servletHandler) isRunning() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, r := range h.replicas {
+		if r.IsRunning() {
+			return true
+		}
 	}
-	return s.testing.servlet.IsRunning()
+	return false
 }
 
-func (s server) HasRunning() bool {
-	return s.running.servlet != nil && s.running.dir != nil
+func (s *server) HasRunning() bool {
+	s.running.mutex.Lock()
+	defer s.running.mutex.Unlock()
+	return len(s.running.replicas) > 0 && s.running.dir != nil
 }
 
 func (s *server) CheckReliability(hostname string) {
-	score, err := s.ReliabilityScore()
+	s.reportNewFingerprints(hostname)
+	missing := s.missingCoverage()
+	result, err := s.ReliabilityScore()
 	if err != nil {
 		log.AddError(err).Debug("While checking reliability")
+	} else {
+		log.Println("reliability of testingServer compared to runningServer: ", result)
+		switch result.Verdict {
+		case scorer.PROMOTE:
+			if len(missing) > 0 {
+				log.Info("Not promoting before testing has enough traffic, missing ", strings.Join(missing, ", "))
+				break
+			}
+			if s.promotionPaused() {
+				log.Info("Testing passed while automatic promotion is paused")
+				return
+			}
+			if s.Frozen() {
+				s.reportFrozenPass(result)
+				return
+			}
+			if s.manualApproval {
+				s.awaitApproval(result)
+				return
+			}
+			if !s.schedule.Allowed(time.Now()) {
+				s.awaitWindow(result.String())
+				return
+			}
+			if !s.claimTesting() {
+				return
+			}
+			go slack.Sendf(" :hourglass: Vili started switching to new version host: %s, from version %s to %s, %s with %s. Worst routes: %s.", hostname, s.GetRunningVersion(), s.GetTestingVersion(), result, fingerprintSummary(s.NewFingerprints()), result.WorstRoutes())
+			s.deploy()
+			go slack.Sendf(" :white_check_mark:  Vili switch to new version complete on host: %s, version %s.", hostname, s.GetRunningVersion())
+			return
+		case scorer.REJECT:
+			if !s.claimTesting() {
+				return
+			}
+			s.abandonWithResult(result)
+			return
+		}
+	}
+	if s.isWaiting() { //Passed testing is not reset while it waits to be deployed
 		return
 	}
-	log.Println("reliabilityScore of testingServer compared to runningServer: ", score)
-	if score >= -50 {
-		s.testing.mutex.Lock()
-		if s.testing.isDying || s.testing.servlet == nil {
-			s.testing.mutex.Unlock()
+	if len(missing) > 0 { //The window is extended until there is enough traffic to judge, but still counts as a window
+		if s.claimExtendedWindow() {
+			s.recordWindow(result, err, "extended, missing "+strings.Join(missing, ", "))
+		}
+		if !s.concludeTesting(hostname, result, err) {
+			s.reportStuck(hostname, missing)
+		}
+		return
+	}
+	if s.claimWindowReset() {
+		s.recordWindow(result, err, "")
+		if s.concludeTesting(hostname, result, err) {
 			return
 		}
-		s.testing.isDying = true
-		s.testing.mutex.Unlock()
-		go slack.Sendf(" :hourglass: Vili started switching to new version host: %s, from version %s to %s.", hostname, s.GetRunningVersion(), s.GetTestingVersion())
-		s.Deploy()
-		go slack.Sendf(" :white_check_mark:  Vili switch to new version complete on host: %s, version %s.", hostname, s.GetRunningVersion())
+		go slack.Sendf(" :recycle: :clock12: Vili restarting test on host: %s, with running version %s and testing version %s after %s with reliability %s(%v).",
+			hostname, s.GetRunningVersion(), s.GetTestingVersion(), s.testWindow, result, err)
+		if err != nil {
+			s.testResetEvent(err.Error(), nil)
+		} else {
+			s.testResetEvent(result.String(), &result.Score)
+		}
+		s.resetTest()
 	}
 }
 
-func (s *server) Kill() {
-	s.cancel()
+// claimTesting makes sure only one check acts on the testing version.
+func (s *server) claimTesting() bool {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	if s.testing.isDying || len(s.testing.replicas) == 0 {
+		return false
+	}
+	s.testing.isDying = true
+	return true
+}
+
+func (s *server) claimWindowReset() bool {
 	s.testing.mutex.Lock()
-	if s.testing.servlet != nil {
-		s.testing.servlet.Kill()
+	defer s.testing.mutex.Unlock()
+	if len(s.testing.replicas) == 0 || time.Since(s.testing.mesureFrom) < s.testWindow {
+		return false
 	}
-	s.testing.mutex.Unlock()
-	s.running.mutex.Lock()
-	if s.running.servlet != nil {
-		s.running.servlet.Kill()
+	s.testing.mesureFrom = time.Now() //Claims the reset so concurrent checks don't reset too
+	return true
+}
+
+// claimExtendedWindow counts a test window that is extended for lack of traffic, without resetting its counters.
+func (s *server) claimExtendedWindow() bool {
+	s.testing.mutex.Lock()
+	defer s.testing.mutex.Unlock()
+	from := s.testing.mesureFrom
+	if s.windowEnded.After(from) {
+		from = s.windowEnded
+	}
+	if len(s.testing.replicas) == 0 || time.Since(from) < s.testWindow {
+		return false
+	}
+	s.windowEnded = time.Now()
+	return true
+}
+
+func (s *server) Kill() {
+	s.cancel()
+	s.testing.kill()
+	s.running.kill()
+	s.previous.kill()
+}
+
+func (h *servletHandler) kill() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, r := range h.replicas {
+		r.markRetired() //Stopping with vili is not a crash
+		r.Kill()
 	}
-	s.running.mutex.Unlock()
 }
@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/cantara/vili/eventlog"
 	"github.com/cantara/vili/fslib"
 )
 
@@ -14,7 +15,7 @@ func setupBase(t *testing.T) (serv Server) {
 		t.Errorf("os.Getwd() got err: %v", err)
 	}
 	from, to := 8000, 8080
-	serv, err = Initialize(&wd, zipperChan, from, to)
+	serv, err = Initialize(&wd, zipperChan, from, to, eventlog.Open(wd.Path()+"/events.jsonl", 0, 0))
 	if err != nil {
 		t.Errorf("Initialize(%s, %p, %d, %d) got err: %v", wd, zipperChan, from, to, err)
 	}
@@ -29,7 +30,7 @@ func TestInitialize(t *testing.T) {
 		t.Errorf("os.Getwd() got err: %v", err)
 	}
 	from, to := 8000, 8080
-	serv, err := Initialize(&wd, zipperChan, from, to)
+	serv, err := Initialize(&wd, zipperChan, from, to, eventlog.Open(wd.Path()+"/events.jsonl", 0, 0))
 	if err != nil {
 		t.Errorf("Initialize(%s, %p, %d, %d) got err: %v", wd, zipperChan, from, to, err)
 	}
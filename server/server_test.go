@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/fingerprint"
+	"github.com/cantara/vili/fs"
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/procstat"
+	"github.com/cantara/vili/quarantine"
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/server/servlet"
+	"github.com/cantara/vili/typelib"
+)
+
+// fakeServlet is a servlet without a process, it is ready at once unless told otherwise.
+type fakeServlet struct {
+	port     string
+	dir      fslib.Dir
+	counters typelib.Counters
+	mutex    sync.Mutex
+	started  time.Time
+	ready    chan struct{}
+	exited   chan struct{}
+	failed   chan string
+	killOnce sync.Once
+}
+
+func newFakeServlet(dir fslib.Dir, port string, ready bool) *fakeServlet {
+	f := &fakeServlet{
+		port:    port,
+		dir:     dir,
+		started: time.Now(),
+		ready:   make(chan struct{}),
+		exited:  make(chan struct{}),
+		failed:  make(chan string, 1),
+	}
+	if ready {
+		close(f.ready)
+	}
+	return f
+}
+
+func (f *fakeServlet) Counters() typelib.Counters {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.counters
+}
+
+func (f *fakeServlet) add(c typelib.Counters) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.counters = f.counters.Add(c)
+}
+
+func (f *fakeServlet) WarmupCounters() typelib.Counters                 { return typelib.Counters{} }
+func (f *fakeServlet) IncrementBreaking(string)                         { f.add(typelib.Counters{Breaking: 1}) }
+func (f *fakeServlet) Observe(typelib.Observation)                      {}
+func (f *fakeServlet) Routes() map[string]typelib.RouteCounters         { return nil }
+func (f *fakeServlet) IncrementErrors()                                 { f.add(typelib.Counters{Errors: 1}) }
+func (f *fakeServlet) IncrementWarnings()                               { f.add(typelib.Counters{Warnings: 1}) }
+func (f *fakeServlet) IncrementRequests()                               { f.add(typelib.Counters{Requests: 1}) }
+func (f *fakeServlet) AddWeight(w int64)                                { f.add(typelib.Counters{Weight: w}) }
+func (f *fakeServlet) Wait()                                            { <-f.exited }
+func (f *fakeServlet) Exited() <-chan struct{}                          { return f.exited }
+func (f *fakeServlet) Failed() <-chan string                            { return f.failed }
+func (f *fakeServlet) Dir() fslib.Dir                                   { return f.dir }
+func (f *fakeServlet) Port() string                                     { return f.port }
+func (f *fakeServlet) Pid() int                                         { return 0 }
+func (f *fakeServlet) Started() time.Time                               { return f.started }
+func (f *fakeServlet) Ready() <-chan struct{}                           { return f.ready }
+func (f *fakeServlet) StartupTime() time.Duration                       { return 0 }
+func (f *fakeServlet) Resources(time.Time) []procstat.Sample            { return nil }
+func (f *fakeServlet) Fingerprints() map[string]fingerprint.Fingerprint { return nil }
+
+func (f *fakeServlet) ResetTestData() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.counters = typelib.Counters{}
+}
+
+func (f *fakeServlet) IsRunning() bool {
+	select {
+	case <-f.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+func (f *fakeServlet) Kill() {
+	f.killOnce.Do(func() { close(f.exited) })
+}
+
+// newTestServer is a server in a temporary base folder with its command watcher running and nothing started.
+func newTestServer(t *testing.T) (s *server, archived chan fslib.Dir) {
+	t.Setenv("identifier", "app")
+	base, err := fslib.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Initialize(&base)
+	q, err := quarantine.Open(base.Path() + "/quarantine.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived = make(chan fslib.Dir, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s = &server{
+		running:              servletHandler{serverType: typelib.RUNNING},
+		testing:              servletHandler{serverType: typelib.TESTING},
+		previous:             servletHandler{serverType: typelib.PREVIOUS},
+		oldFolders:           archived,
+		serverCommands:       make(chan commandData, 5),
+		dir:                  &base,
+		cancel:               cancel,
+		replicas:             1,
+		hostname:             "test",
+		scorer:               scorer.Absolute{Checks: scorer.ChecksFromEnv(), Threshold: -50},
+		minTestDuration:      time.Minute,
+		testWindow:           time.Minute * 15,
+		readyTimeout:         time.Second,
+		quarantine:           q,
+		events:               eventlog.Open(base.Path()+"/events.jsonl", 0, 0),
+		started:              time.Now(),
+		reportedFingerprints: make(map[string]bool),
+		newServlet: func(servletDir fslib.Dir, port string, _ typelib.ServerType) (servlet.Servlet, error) {
+			return newFakeServlet(servletDir, port, true), nil
+		},
+	}
+	s.setAvailablePorts(9000, 9010)
+	go s.newServerWatcher(ctx)
+	return
+}
+
+// versionDir creates a version folder with an empty jar, like the ones vili creates for new jars.
+func versionDir(t *testing.T, s *server, version string) fslib.Dir {
+	dir, err := s.dir.Mkdir(version, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar, err := dir.Create(version + ".jar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar.Close()
+	return dir
+}
+
+// addReplica puts a ready fake replica of dir in t without going through the command watcher.
+func addReplica(s *server, t typelib.ServerType, dir fslib.Dir) (*replica, *fakeServlet) {
+	f := newFakeServlet(dir, s.getAvailablePort(), true)
+	r := &replica{Servlet: f, serverType: t, version: dir.File().Name()}
+	h := s.handler(t)
+	h.mutex.Lock()
+	h.replicas = append(h.replicas, r)
+	h.dir = dir
+	h.mesureFrom = time.Now()
+	h.mutex.Unlock()
+	return r, f
+}
+
+// versions lists the version of every replica of t.
+func versions(s *server, t typelib.ServerType) (versions []string) {
+	h := s.handler(t)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, r := range h.replicas {
+		versions = append(versions, r.version)
+	}
+	return
+}
+
+func expectArchived(t *testing.T, archived chan fslib.Dir, version string) {
+	t.Helper()
+	select {
+	case dir := <-archived:
+		if dir.File().Name() != version {
+			t.Errorf("Archived %s, expected %s", dir.File().Name(), version)
+		}
+	case <-time.After(time.Second * 5):
+		t.Errorf("%s was not archived", version)
+	}
+}
+
+func expectNotArchived(t *testing.T, archived chan fslib.Dir) {
+	t.Helper()
+	select {
+	case dir := <-archived:
+		t.Errorf("%s was archived", dir.File().Name())
+	default:
+	}
+}
+
+func TestPartialRollout(t *testing.T) {
+	s, archived := newTestServer(t)
+	s.replicas = 2
+	old := versionDir(t, s, "app-1.0.0")
+	_, first := addReplica(s, typelib.RUNNING, old)
+	_, second := addReplica(s, typelib.RUNNING, old)
+	versionDir(t, s, "app-1.1.0")
+	starts := 0
+	s.newServlet = func(servletDir fslib.Dir, port string, _ typelib.ServerType) (servlet.Servlet, error) {
+		if strings.Contains(servletDir.Path(), "app-1.1.0") {
+			starts++
+			if starts == 2 {
+				return nil, errors.New("no java")
+			}
+		}
+		return newFakeServlet(servletDir, port, true), nil
+	}
+
+	if err := s.Restore("app-1.1.0", nil, true); err == nil {
+		t.Fatal("Rollout where the second replica fails to start should fail")
+	}
+	if v := versions(s, typelib.RUNNING); len(v) != 2 || v[0] != "app-1.0.0" || v[1] != "app-1.0.0" {
+		t.Errorf("Running %v after a partial rollout, expected two replicas of app-1.0.0", v)
+	}
+	if s.GetRunningVersion() != "app-1.0.0" {
+		t.Errorf("Running version is %s, expected app-1.0.0", s.GetRunningVersion())
+	}
+	if first.IsRunning() || second.IsRunning() {
+		if first.IsRunning() == second.IsRunning() {
+			t.Error("Only the replica replaced by the new version should have been stopped")
+		}
+	} else {
+		t.Error("The replica that was not replaced should still be running")
+	}
+	expectNotArchived(t, archived)
+}
+
+func TestRestartReplicaWaitsForReady(t *testing.T) {
+	s, _ := newTestServer(t)
+	dir := versionDir(t, s, "app-1.0.0")
+	old, stopped := addReplica(s, typelib.RUNNING, dir)
+	stopped.Kill()
+	started := make(chan *fakeServlet, 2)
+	s.newServlet = func(servletDir fslib.Dir, port string, _ typelib.ServerType) (servlet.Servlet, error) {
+		f := newFakeServlet(servletDir, port, false)
+		started <- f
+		return f, nil
+	}
+
+	s.serverCommands <- commandData{command: restartServer, serverType: typelib.RUNNING, replica: old}
+	replacement := <-started
+	time.Sleep(time.Millisecond * 100)
+	s.running.mutex.Lock()
+	if len(s.running.replicas) != 1 || s.running.replicas[0] != old {
+		t.Error("The replacement got traffic before it was ready")
+	}
+	s.running.mutex.Unlock()
+	close(replacement.ready)
+	deadline := time.Now().Add(time.Second * 5)
+	for s.running.isRolling() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	s.running.mutex.Lock()
+	if len(s.running.replicas) != 1 || s.running.replicas[0].Servlet != replacement || !old.isRetired() {
+		t.Error("The ready replacement did not take the place of the stopped replica")
+	}
+	s.running.mutex.Unlock()
+
+	s.readyTimeout = time.Millisecond * 50
+	current := s.running.replicas[0]
+	s.serverCommands <- commandData{command: restartServer, serverType: typelib.RUNNING, replica: current}
+	neverReady := <-started
+	<-neverReady.Exited()
+	deadline = time.Now().Add(time.Second * 5)
+	for s.running.isRolling() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	s.running.mutex.Lock()
+	if len(s.running.replicas) != 1 || s.running.replicas[0] != current || current.isRetired() {
+		t.Error("A replacement that was never ready took the place of the replica")
+	}
+	s.running.mutex.Unlock()
+}
+
+func TestFailedPromotionAbandonsTesting(t *testing.T) {
+	s, archived := newTestServer(t)
+	addReplica(s, typelib.RUNNING, versionDir(t, s, "app-1.0.0"))
+	candidate := versionDir(t, s, "app-1.1.0")
+	addReplica(s, typelib.TESTING, candidate)
+	if err := candidate.Symlink(candidate.File(), "app-test"); err != nil {
+		t.Fatal(err)
+	}
+	s.newServlet = func(servletDir fslib.Dir, port string, _ typelib.ServerType) (servlet.Servlet, error) {
+		if strings.Contains(servletDir.Path(), "app-1.1.0") {
+			return nil, errors.New("no java")
+		}
+		return newFakeServlet(servletDir, port, true), nil
+	}
+
+	if err := s.deploy(); err == nil {
+		t.Fatal("Promotion of a version that does not start should fail")
+	}
+	if s.GetRunningVersion() != "app-1.0.0" {
+		t.Errorf("Running version is %s, expected app-1.0.0", s.GetRunningVersion())
+	}
+	if !s.Quarantined("app-1.1.0") {
+		t.Error("The version that failed to roll out is not quarantined")
+	}
+	if _, err := os.Lstat(filepath.Join(s.dir.Path(), "app-test")); !os.IsNotExist(err) {
+		t.Errorf("The testing link is still there, %v", err)
+	}
+	expectArchived(t, archived, "app-1.1.0")
+}
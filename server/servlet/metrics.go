@@ -0,0 +1,15 @@
+package servlet
+
+import (
+	"github.com/cantara/vili/metrics"
+)
+
+var (
+	breakingTotal = metrics.NewCounter("vili_breaking_total", "Breaking responses after warm-up by role.", "role")
+	errorsTotal   = metrics.NewCounter("vili_errors_total", "Logged errors after warm-up by role.", "role")
+	warningsTotal = metrics.NewCounter("vili_warnings_total", "Logged warnings after warm-up by role.", "role")
+)
+
+func init() {
+	metrics.Register(breakingTotal, errorsTotal, warningsTotal)
+}
@@ -0,0 +1,105 @@
+package servlet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	log "github.com/cantara/bragi"
+)
+
+const readyProbeInterval = time.Millisecond * 500
+
+func readyLogRegexFromEnv() *regexp.Regexp {
+	expr := os.Getenv("ready_log_regex")
+	if expr == "" {
+		return nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		log.AddError(err).Warning("Invalid ready_log_regex, probing for readiness instead")
+		return nil
+	}
+	return re
+}
+
+func (s *servlet) Started() time.Time {
+	return s.started
+}
+
+func (s *servlet) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// StartupTime is zero until the servlet is ready.
+func (s *servlet) StartupTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.startup))
+}
+
+func (s *servlet) markReady() {
+	s.readyOnce.Do(func() {
+		startup := time.Since(s.started)
+		atomic.StoreInt64(&s.startup, int64(startup))
+		atomic.StoreInt64(&s.steadyFrom, time.Now().Add(s.warmup).UnixNano())
+		close(s.ready)
+		log.Info("Servlet on port ", s.port, " ready after ", startup)
+		out, err := s.dir.Create("startup")
+		if err != nil {
+			log.AddError(err).Warning("While persisting startup time")
+			return
+		}
+		defer out.Close()
+		fmt.Fprintln(out, startup)
+	})
+}
+
+func (s *servlet) waitReady(ctx context.Context) {
+	timeout := time.NewTimer(s.readyTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(readyProbeInterval)
+	defer ticker.Stop()
+	path := os.Getenv("ready_path")
+	client := http.Client{Timeout: readyProbeInterval * 2}
+	for {
+		select {
+		case <-s.ready:
+			return
+		case <-ticker.C:
+			if s.readyLog != nil && path == "" { //Readiness comes from the log parser
+				continue
+			}
+			if s.probe(&client, path) {
+				s.markReady()
+				return
+			}
+		case <-timeout.C:
+			log.Warning("Servlet on port ", s.port, " was not ready within timeout")
+			s.fail(fmt.Sprintf("not ready within %s", s.readyTimeout))
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *servlet) probe(client *http.Client, path string) bool {
+	if path == "" {
+		conn, err := net.DialTimeout("tcp", "localhost:"+s.port, readyProbeInterval)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%s%s", s.port, path))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
@@ -0,0 +1,33 @@
+package servlet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cantara/vili/fingerprint"
+	"github.com/cantara/vili/typelib"
+)
+
+func TestWarmingUp(t *testing.T) {
+	s := &servlet{
+		started:      time.Now(),
+		ready:        make(chan struct{}),
+		warmup:       time.Hour,
+		readyTimeout: time.Hour,
+		fingerprints: make(map[string]fingerprint.Fingerprint),
+		routes:       make(map[string]typelib.RouteCounters),
+	}
+	e := fingerprint.Parse("java.lang.IllegalStateException: a\n\tat com.acme.A.b(A.java:1)")[0]
+	s.IncrementErrors()
+	s.addException(e)
+	if s.Counters().Errors != 0 || s.WarmupCounters().Errors != 1 || len(s.Fingerprints()) != 0 {
+		t.Errorf("Errors and exceptions before ready should be kept apart, counters %+v, warm-up %+v, fingerprints %v", s.Counters(), s.WarmupCounters(), s.Fingerprints())
+	}
+
+	s.started = time.Now().Add(-2 * time.Hour) //Never got ready within ready_timeout
+	s.IncrementErrors()
+	s.addException(e)
+	if s.Counters().Errors != 1 || len(s.Fingerprints()) != 1 {
+		t.Errorf("Warm-up should end after ready_timeout, counters %+v, fingerprints %v", s.Counters(), s.Fingerprints())
+	}
+}
@@ -6,28 +6,54 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 
 	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/envlib"
+	"github.com/cantara/vili/fingerprint"
 	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/logparse"
+	"github.com/cantara/vili/logrules"
+	"github.com/cantara/vili/procstat"
 	"github.com/cantara/vili/tail"
+	"github.com/cantara/vili/typelib"
 )
 
 type servlet struct {
-	port     string
-	dir      fslib.Dir
-	errors   int64
-	warnings int64
-	breaking int64
-	requests int64
-	cmd      *exec.Cmd
-	version  string
-	ctx      context.Context
-	once     sync.Once
-	kill     func()
+	port             string
+	dir              fslib.Dir
+	serverType       typelib.ServerType
+	errors           int64
+	warnings         int64
+	breaking         int64
+	requests         int64
+	weight           int64
+	fingerprints     map[string]fingerprint.Fingerprint
+	fingerprinting   fingerprint.Config
+	fingerprintMutex sync.Mutex
+	routes           map[string]typelib.RouteCounters
+	routeMutex       sync.Mutex
+	resources        []procstat.Sample
+	resourceMutex    sync.Mutex
+	cmd              *exec.Cmd
+	version          string
+	ctx              context.Context
+	exited           chan struct{}
+	failed           chan string
+	started          time.Time
+	startup          int64
+	ready            chan struct{}
+	readyOnce        sync.Once
+	readyLog         *regexp.Regexp
+	warmup           time.Duration
+	readyTimeout     time.Duration
+	steadyFrom       int64
+	warmupCounters   typelib.Counters
+	warmupMutex      sync.Mutex
+	kill             func()
 }
 
 func (s *servlet) Kill() {
@@ -35,51 +61,188 @@ func (s *servlet) Kill() {
 }
 
 func (s *servlet) Wait() {
-	s.cmd.Wait()
+	<-s.exited
 }
 
-func (s servlet) Dir() fslib.Dir {
+func (s *servlet) Exited() <-chan struct{} {
+	return s.exited
+}
+
+func (s *servlet) Failed() <-chan string {
+	return s.failed
+}
+
+func (s *servlet) fail(reason string) {
+	select {
+	case s.failed <- reason:
+	default: //A failure is allready waiting to be handled
+	}
+}
+
+func (s *servlet) Dir() fslib.Dir {
 	return s.dir
 }
 
-func (s servlet) Port() string {
+func (s *servlet) Port() string {
 	return s.port
 }
 
-func (s servlet) ReliabilityScore() int64 {
-	return s.requests - s.breaking*100 - s.errors*10 - s.warnings
+func (s *servlet) Pid() int {
+	return s.cmd.Process.Pid
+}
+
+func (s *servlet) Counters() typelib.Counters {
+	return typelib.Counters{
+		Requests: atomic.LoadInt64(&s.requests),
+		Breaking: atomic.LoadInt64(&s.breaking),
+		Errors:   atomic.LoadInt64(&s.errors),
+		Warnings: atomic.LoadInt64(&s.warnings),
+		Weight:   atomic.LoadInt64(&s.weight),
+	}
 }
 
-func (s *servlet) IncrementBreaking() {
+func (s *servlet) IncrementBreaking(route string) {
+	if s.warmingUp() {
+		s.addWarmup(typelib.Counters{Breaking: 1})
+		return
+	}
 	atomic.AddInt64(&s.breaking, 1)
+	breakingTotal.Inc(s.serverType.String())
+	s.routeMutex.Lock()
+	defer s.routeMutex.Unlock()
+	c := s.routes[route]
+	c.Breaking++
+	s.routes[route] = c
+}
+
+func (s *servlet) Observe(o typelib.Observation) {
+	if s.warmingUp() {
+		return
+	}
+	s.routeMutex.Lock()
+	defer s.routeMutex.Unlock()
+	c := s.routes[o.Route]
+	c.Requests++
+	c.StatusClasses[typelib.StatusClass(o.Status)]++
+	c.Latency += o.Latency
+	s.routes[o.Route] = c
+}
+
+func (s *servlet) Routes() map[string]typelib.RouteCounters {
+	s.routeMutex.Lock()
+	defer s.routeMutex.Unlock()
+	out := make(map[string]typelib.RouteCounters, len(s.routes))
+	for route, c := range s.routes {
+		out[route] = c
+	}
+	return out
 }
 
 func (s *servlet) IncrementErrors() {
+	if s.warmingUp() {
+		s.addWarmup(typelib.Counters{Errors: 1})
+		return
+	}
 	atomic.AddInt64(&s.errors, 1)
+	errorsTotal.Inc(s.serverType.String())
 }
 
 func (s *servlet) IncrementWarnings() {
+	if s.warmingUp() {
+		s.addWarmup(typelib.Counters{Warnings: 1})
+		return
+	}
 	atomic.AddInt64(&s.warnings, 1)
+	warningsTotal.Inc(s.serverType.String())
 }
 
 func (s *servlet) IncrementRequests() {
+	if s.warmingUp() {
+		s.addWarmup(typelib.Counters{Requests: 1})
+		return
+	}
 	atomic.AddInt64(&s.requests, 1)
 }
 
-func (s *servlet) ResetTestData() {
+func (s *servlet) AddWeight(weight int64) {
+	if s.warmingUp() {
+		s.addWarmup(typelib.Counters{Weight: weight})
+		return
+	}
+	atomic.AddInt64(&s.weight, weight)
+}
+
+// warmingUp is true until the servlet has been ready for the warm-up period, a servlet that never gets ready stops warming up after ready_timeout.
+func (s *servlet) warmingUp() bool {
+	steadyFrom := atomic.LoadInt64(&s.steadyFrom)
+	if steadyFrom == 0 {
+		return time.Since(s.started) < s.readyTimeout
+	}
+	return time.Now().UnixNano() < steadyFrom
+}
+
+func (s *servlet) addWarmup(c typelib.Counters) {
+	s.warmupMutex.Lock()
+	defer s.warmupMutex.Unlock()
+	s.warmupCounters = s.warmupCounters.Add(c)
+}
+
+func (s *servlet) WarmupCounters() typelib.Counters {
+	s.warmupMutex.Lock()
+	defer s.warmupMutex.Unlock()
+	return s.warmupCounters
+}
+
+func (s *servlet) addException(e fingerprint.Exception) {
+	fp := e.Fingerprint(s.fingerprinting)
+	if s.warmingUp() { //Exceptions while starting are not what the version does in steady state
+		log.Debug("Ignoring exception fingerprint ", fp.Id, " during warm-up on port ", s.port)
+		return
+	}
+	s.fingerprintMutex.Lock()
+	defer s.fingerprintMutex.Unlock()
+	if known, ok := s.fingerprints[fp.Id]; ok {
+		known.Count++
+		s.fingerprints[fp.Id] = known
+		return
+	}
+	fp.Count = 1
+	fp.FirstSeen = time.Now()
+	s.fingerprints[fp.Id] = fp
+	log.Info("New exception fingerprint ", fp.Id, " ", fp.Type, " on port ", s.port)
+}
+
+func (s *servlet) Fingerprints() map[string]fingerprint.Fingerprint {
+	s.fingerprintMutex.Lock()
+	defer s.fingerprintMutex.Unlock()
+	out := make(map[string]fingerprint.Fingerprint, len(s.fingerprints))
+	for id, fp := range s.fingerprints {
+		out[id] = fp
+	}
+	return out
+}
+
+func (s *servlet) ResetTestData() { //Fingerprints are kept for the lifetime of the servlet
 	atomic.StoreInt64(&s.warnings, 0)
 	atomic.StoreInt64(&s.errors, 0)
 	atomic.StoreInt64(&s.breaking, 0)
 	atomic.StoreInt64(&s.requests, 0)
+	atomic.StoreInt64(&s.weight, 0)
+	s.routeMutex.Lock()
+	s.routes = make(map[string]typelib.RouteCounters)
+	s.routeMutex.Unlock()
 }
 
-func (s servlet) IsRunning() bool {
-	log.Debug(s.cmd.Process.Pid)
-	log.Debug(s.cmd)
-	return s.cmd.Process.Signal(syscall.Signal(0)) == nil
+func (s *servlet) IsRunning() bool {
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
 }
 
-func NewServlet(servletDir fslib.Dir, port string) (s *servlet, err error) {
+func NewServlet(servletDir fslib.Dir, port string, t typelib.ServerType) (s *servlet, err error) {
 	stdOut, err := servletDir.Create("stdOut") //, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		return
@@ -92,7 +255,6 @@ func NewServlet(servletDir fslib.Dir, port string) (s *servlet, err error) {
 	if err != nil {
 		return
 	}
-	ctx, cancel := context.WithCancel(context.Background())
 	cmd := exec.Command("java", "-jar", server.Path()) //fmt.Sprintf("%s/%s.jar", servletDir.Path(), os.Getenv("identifier")))
 	if os.Getenv("properties_file_name") == "" {
 		cmd = exec.Command("java", fmt.Sprintf("-D%s=%s", os.Getenv("port_identifier"), port), "-jar", server.Path()) //fmt.Sprintf("%s/%s.jar", servletDir.Path(), os.Getenv("identifier")))
@@ -101,49 +263,135 @@ func NewServlet(servletDir fslib.Dir, port string) (s *servlet, err error) {
 	cmd.Stdout = stdOut
 	cmd.Stderr = stdErr
 	log.Debug(cmd)
+	started := time.Now()
 	err = cmd.Start()
 	if err != nil {
 		return
 	}
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			log.Println(err)
+		}
+		close(exited)
+	}()
 	pid, err := servletDir.Create("pid") //, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err == nil {
 		fmt.Fprintln(pid, cmd.Process.Pid)
 		pid.Close()
 	}
 	time.Sleep(time.Second * 2) //Sleep an arbitrary amout of time so the service can start without getting any new request, this should not be needed
+	ctx, cancel := context.WithCancel(context.Background())
 	s = &servlet{
-		port: port,
-		dir:  servletDir,
-		cmd:  cmd,
-		ctx:  ctx,
+		port:           port,
+		dir:            servletDir,
+		serverType:     t,
+		fingerprints:   make(map[string]fingerprint.Fingerprint),
+		fingerprinting: fingerprint.ConfigFromEnv(),
+		routes:         make(map[string]typelib.RouteCounters),
+		cmd:            cmd,
+		ctx:            ctx,
+		exited:         exited,
+		failed:         make(chan string, 1),
+		started:        started,
+		ready:          make(chan struct{}),
+		readyLog:       readyLogRegexFromEnv(),
+		warmup:         envlib.Duration("warmup", time.Minute),
+		readyTimeout:   envlib.Duration("ready_timeout", time.Minute*5),
 		kill: func() {
 			err := cmd.Process.Kill() //.Signal(syscall.SIGTERM)
 			if err != nil {
 				log.Println(err)
 			}
-			err = cmd.Wait()
-			if err != nil {
-				log.Println(err)
-			}
+			<-exited
 			cancel()
 			stdOut.Close()
 			stdErr.Close()
 		},
 	}
 	go s.parseLogServer(ctx)
+	go s.sampleResources(ctx)
+	go s.waitReady(ctx)
 	return
 }
 
-type logData struct {
-	Level string `json:"level"`
+const maxResourceSamples = 2880
+
+func (s *servlet) sampleResources(ctx context.Context) {
+	out, err := s.dir.Create("resources")
+	if err != nil {
+		log.AddError(err).Warning("While creating resources file, only keeping samples in memory")
+	} else {
+		defer out.Close()
+	}
+	ticker := time.NewTicker(envlib.Duration("resource_sample_interval", time.Second*30))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sample, err := procstat.Read(s.Pid())
+			if err != nil {
+				log.AddError(err).Debug("While sampling servlet resources")
+				continue
+			}
+			s.resourceMutex.Lock()
+			s.resources = append(s.resources, sample)
+			if len(s.resources) > maxResourceSamples {
+				s.resources = s.resources[len(s.resources)-maxResourceSamples:]
+			}
+			s.resourceMutex.Unlock()
+			if out == nil {
+				continue
+			}
+			line, err := json.Marshal(sample)
+			if err != nil {
+				continue
+			}
+			out.Write(append(line, '\n'))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *servlet) Resources(since time.Time) (samples []procstat.Sample) {
+	s.resourceMutex.Lock()
+	defer s.resourceMutex.Unlock()
+	for _, sample := range s.resources {
+		if sample.Time.Before(since) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return
 }
 
 func (servlet *servlet) parseLogServer(ctx context.Context) {
-	lineChan, err := tail.File(fmt.Sprintf("%s/logs/json/%s.log", servlet.cmd.Dir, os.Getenv("identifier")), ctx)
+	sources, err := logparse.SourcesFromEnv()
+	if err != nil {
+		log.AddError(err).Error("While reading log sources") //TODO look into what can be done here
+		return
+	}
+	rules, err := logrules.FromEnv()
+	if err != nil {
+		log.AddError(err).Error("While reading log rules, continuing without rules")
+	}
+	for _, source := range sources {
+		go servlet.parseLogSource(ctx, source, rules)
+	}
+}
+
+func (servlet *servlet) parseLogSource(ctx context.Context, source logparse.Source, rules logrules.Rules) {
+	lineChan, err := tail.File(fmt.Sprintf("%s/%s", servlet.cmd.Dir, source.Path), ctx)
 	if err != nil {
-		log.AddError(err).Error("While trying to tail log file") //TODO look into what can be done here
+		log.AddError(err).Error("While trying to tail log file ", source.Path) //TODO look into what can be done here
 		return
 	}
+	var collector fingerprint.Collector
+	var lastLine time.Time
+	flush := time.NewTicker(time.Second)
+	defer flush.Stop()
 	for {
 		select {
 		case line, ok := <-lineChan:
@@ -151,19 +399,48 @@ func (servlet *servlet) parseLogServer(ctx context.Context) {
 				log.Println("LineChan closed closing log parser")
 				return
 			}
+			lastLine = time.Now()
+			if servlet.readyLog != nil && servlet.readyLog.Match(line) {
+				servlet.markReady()
+			}
+			if e := collector.Add(string(line)); e != nil {
+				servlet.addException(*e)
+			}
 			//TODO Should this check if we are messuring or just count as normal all the time?
-			var data logData
-			err := json.Unmarshal(line, &data)
+			entry, err := source.Parser.Parse(line)
 			if err != nil {
-				log.Println(err)
+				if !collector.Pending() { //Stack trace lines are expected to not be parsable
+					log.Println(err)
+				}
 				continue
 			}
-			switch data.Level {
-			case "WARN":
+			if entry.StackTrace != "" {
+				for _, e := range fingerprint.Parse(entry.StackTrace) {
+					servlet.addException(e)
+				}
+			}
+			if rule := rules.Match(entry); rule != nil {
+				switch rule.Act() {
+				case logrules.WEIGHT:
+					servlet.AddWeight(rule.Weight)
+				case logrules.FAIL:
+					log.Warning("Log rule ", rule.Name, " failed servlet on port ", servlet.port)
+					servlet.fail(fmt.Sprintf("log rule %s matched: %s", rule.Name, entry.Message))
+				}
+				continue
+			}
+			switch entry.Level {
+			case logparse.WARN:
 				servlet.IncrementWarnings()
-			case "ERROR":
+			case logparse.ERROR:
 				servlet.IncrementErrors()
 			}
+		case <-flush.C:
+			if collector.Pending() && time.Since(lastLine) > time.Second*2 { //The last stack trace in a quiet log has no following line to end it
+				if e := collector.Flush(); e != nil {
+					servlet.addException(*e)
+				}
+			}
 		case <-ctx.Done():
 			log.Println("Closing log parser")
 			return
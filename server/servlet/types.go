@@ -1,17 +1,36 @@
 package servlet
 
-import "github.com/cantara/vili/fslib"
+import (
+	"time"
+
+	"github.com/cantara/vili/fingerprint"
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/procstat"
+	"github.com/cantara/vili/typelib"
+)
 
 type Servlet interface {
-	ReliabilityScore() int64
-	IncrementBreaking()
+	Counters() typelib.Counters
+	WarmupCounters() typelib.Counters
+	IncrementBreaking(string)
+	Observe(typelib.Observation)
+	Routes() map[string]typelib.RouteCounters
 	IncrementErrors()
 	IncrementWarnings()
 	IncrementRequests()
+	AddWeight(int64)
 	ResetTestData()
 	IsRunning() bool
 	Kill()
 	Wait()
+	Exited() <-chan struct{}
+	Failed() <-chan string
 	Dir() fslib.Dir
 	Port() string
+	Pid() int
+	Started() time.Time
+	Ready() <-chan struct{}
+	StartupTime() time.Duration
+	Resources(time.Time) []procstat.Sample
+	Fingerprints() map[string]fingerprint.Fingerprint
 }
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/typelib"
+)
+
+type ReplicaStatus struct {
+	Port        string           `json:"port"`
+	Pid         int              `json:"pid"`
+	Healthy     bool             `json:"healthy"`
+	Ready       bool             `json:"ready"`
+	Active      int64            `json:"active"`
+	Uptime      time.Duration    `json:"uptime"`
+	StartupTime time.Duration    `json:"startup_time"`
+	Counters    typelib.Counters `json:"counters"`
+}
+
+type VersionStatus struct {
+	Version     string           `json:"version"`
+	Replicas    []ReplicaStatus  `json:"replicas"`
+	Counters    typelib.Counters `json:"counters"`
+	MesureFrom  time.Time        `json:"mesure_from"`
+	WarmupTotal typelib.Counters `json:"warmup"`
+}
+
+type Status struct {
+	Hostname         string         `json:"hostname"`
+	Uptime           time.Duration  `json:"uptime"`
+	Running          *VersionStatus `json:"running,omitempty"`
+	Testing          *VersionStatus `json:"testing,omitempty"`
+	Previous         *VersionStatus `json:"previous,omitempty"`
+	TestingDuration  time.Duration  `json:"testing_duration"`
+	TestWindows      []string       `json:"test_windows,omitempty"`
+	Score            *scorer.Result `json:"score,omitempty"`
+	ScoreError       string         `json:"score_error,omitempty"`
+	Paused           bool           `json:"paused"`
+	Frozen           bool           `json:"frozen"`
+	HeldVersion      string         `json:"held_version,omitempty"`
+	AwaitingApproval bool           `json:"awaiting_approval"`
+	WaitingForWindow bool           `json:"waiting_for_window"`
+}
+
+func (h *servletHandler) status() *VersionStatus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.dir == nil || len(h.replicas) == 0 {
+		return nil
+	}
+	vs := &VersionStatus{
+		Version:    h.dir.File().Name(),
+		MesureFrom: h.mesureFrom,
+	}
+	for _, r := range h.replicas {
+		rs := ReplicaStatus{
+			Port:        r.Port(),
+			Pid:         r.Pid(),
+			Healthy:     r.healthy(),
+			Active:      atomic.LoadInt64(&r.active),
+			Uptime:      time.Since(r.Started()),
+			StartupTime: r.StartupTime(),
+			Counters:    r.Counters(),
+		}
+		select {
+		case <-r.Ready():
+			rs.Ready = true
+		default:
+		}
+		vs.Replicas = append(vs.Replicas, rs)
+		vs.Counters = vs.Counters.Add(rs.Counters)
+		vs.WarmupTotal = vs.WarmupTotal.Add(r.WarmupCounters())
+	}
+	return vs
+}
+
+// Status is a snapshot of what vili is doing, it only reads and never goes through the command watcher.
+func (s *server) Status() (st Status) {
+	st = Status{
+		Hostname:        s.hostname,
+		Uptime:          time.Since(s.started),
+		Running:         s.running.status(),
+		Testing:         s.testing.status(),
+		Previous:        s.previous.status(),
+		TestingDuration: s.TestingDuration(),
+	}
+	s.testing.mutex.Lock()
+	st.TestWindows = append(st.TestWindows, s.windows...)
+	st.Paused = s.paused
+	st.AwaitingApproval = s.awaitingApproval
+	st.WaitingForWindow = s.waiting
+	s.testing.mutex.Unlock()
+	st.Frozen = s.Frozen()
+	st.HeldVersion = s.HeldVersion()
+	if st.Testing == nil {
+		return
+	}
+	result, err := s.ReliabilityScore()
+	if err != nil {
+		st.ScoreError = err.Error()
+		return
+	}
+	result.Score = finiteScore(result.Score)
+	st.Score = &result
+	return
+}
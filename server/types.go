@@ -1,27 +1,60 @@
 package server
 
-import "time"
+import (
+	"time"
+
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/fingerprint"
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/quarantine"
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/typelib"
+)
 
 type Server interface {
 	NewTesting(string) error
-	Deploy() error
-	RestartRunning()
-	RestartTesting()
+	Deploy(wait bool) (queued bool, err error)
+	AbandonTesting(string) error
+	Approve() error
+	Reject(string) error
+	AwaitingApproval() bool
+	RestartRunning() error
+	RestartTesting() error
+	PausePromotion() error
+	ResumePromotion() error
+	Freeze() error
+	Unfreeze() error
+	Frozen() bool
+	Status() Status
 	GetRunningVersion() string
 	GetTestingVersion() string
-	GetPortRunning() string
-	GetPortTesting() string
-	AddBreaking()
-	AddRequestRunning()
-	AddRequestTesting()
+	Acquire(typelib.ServerType) (Upstream, error)
+	AddBreaking(string)
+	AddWatchBreaking(string)
+	HasPrevious() bool
+	Rollback(string) error
+	Restore(string, func(string, fslib.Dir) (fslib.Dir, error), bool) error
+	Events(eventlog.Filter) ([]eventlog.Event, error)
+	Scores() []ScorePoint
+	AddMismatch(Mismatch)
+	Mismatches() []Mismatch
+	Quarantined(string) bool
+	QuarantineList() []quarantine.Entry
+	Unquarantine(string) error
 	HasRunning() bool
 	HasTesting() bool
 	TestingDuration() time.Duration
 	Messuring() bool
-	ResetTest()
+	ResetTest() error
 	IsRunningRunning() bool
 	IsTestingRunning() bool
 	CheckReliability(string)
-	ReliabilityScore() (int64, error)
+	ReliabilityScore() (scorer.Result, error)
+	NewFingerprints() []fingerprint.Fingerprint
 	Kill()
 }
+
+type Upstream interface {
+	Port() string
+	Done(typelib.Observation, error)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/eventlog"
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/server/scorer"
+	"github.com/cantara/vili/slack"
+)
+
+const watchCheckInterval = time.Second * 30
+
+// startWatch keeps the replaced version warm as previous so the promotion can be rolled back.
+func (s *server) startWatch(kept *replica, oldFolder fslib.Dir) {
+	s.running.mutex.Lock()
+	partial := s.running.contains(kept)
+	s.running.mutex.Unlock()
+	if partial { //Some old replicas are still running, there is nothing to roll back to
+		log.Warning("Not watching promotion of ", s.GetRunningVersion(), ", old replicas are still running")
+		return
+	}
+	s.previous.mutex.Lock()
+	s.previous.replicas = []*replica{kept}
+	s.previous.dir = oldFolder
+	s.previous.mutex.Unlock()
+	s.previous.resetTestData()
+	s.running.resetTestData()
+	until := time.Now().Add(s.watchPeriod)
+	log.Info("Watching ", s.GetRunningVersion(), " against ", oldFolder.File().Name(), " until ", until)
+	go slack.Sendf(" :eyes: Vili is watching version %s on host: %s for %s, version %s is kept for rollback.", s.GetRunningVersion(), s.hostname, s.watchPeriod, oldFolder.File().Name())
+	go s.watchPromotion(oldFolder, until)
+}
+
+func (s *server) watching(previousDir fslib.Dir) bool {
+	s.previous.mutex.Lock()
+	defer s.previous.mutex.Unlock()
+	return len(s.previous.replicas) > 0 && s.previous.dir != nil && previousDir != nil && s.previous.dir.Path() == previousDir.Path()
+}
+
+func (s *server) watchPromotion(previousDir fslib.Dir, until time.Time) {
+	ticker := time.NewTicker(watchCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !s.watching(previousDir) {
+			return
+		}
+		if time.Now().After(until) {
+			s.serverCommands <- commandData{command: endWatch, serverDir: previousDir}
+			return
+		}
+		result := s.watchScore()
+		log.Debug("Watch of running compared to previous: ", result)
+		if result.Verdict == scorer.REJECT && s.Frozen() {
+			log.Warning("Not rolling back while frozen, running compared to previous: ", result)
+			continue
+		}
+		if result.Verdict == scorer.REJECT { //Keeps watching in case running is being replaced and the rollback has to wait
+			s.serverCommands <- commandData{command: rollback, serverDir: previousDir, reason: result.String()}
+		}
+	}
+}
+
+func (s *server) watchScore() scorer.Result {
+	s.running.mutex.Lock()
+	from := s.running.mesureFrom
+	s.running.mutex.Unlock()
+	return s.watchScorer.Score(scorer.Input{
+		Running:       s.previous.counters(),
+		Testing:       s.running.counters(),
+		RunningRoutes: s.previous.routes(),
+		TestingRoutes: s.running.routes(),
+		Duration:      time.Since(from),
+	})
+}
+
+// endWatch archives the previous version, it is run from the command watcher.
+func (s *server) endWatch() {
+	s.previous.mutex.Lock()
+	replicas := s.previous.replicas
+	dir := s.previous.dir
+	s.previous.replicas = nil
+	s.previous.dir = nil
+	s.previous.mutex.Unlock()
+	if len(replicas) == 0 {
+		return
+	}
+	for _, r := range replicas {
+		s.retire(r)
+	}
+	s.archive(dir)
+}
+
+// rollback makes previous running again and quarantines the version it replaces, it is run from the command watcher.
+// The outcome is sent on errorChan once the replicas of previous are started.
+func (s *server) rollback(previousDir fslib.Dir, reason string, errorChan chan error) {
+	if previousDir != nil && !s.watching(previousDir) {
+		log.Debug("Rollback request for a watch that has ended")
+		respond(errorChan, nil)
+		return
+	}
+	s.previous.mutex.Lock()
+	previous := s.previous.replicas
+	dir := s.previous.dir
+	s.previous.replicas = nil
+	s.previous.dir = nil
+	s.previous.mutex.Unlock()
+	if len(previous) == 0 {
+		respond(errorChan, fmt.Errorf("No previous version to roll back to"))
+		return
+	}
+
+	warm := previous[0].IsRunning()
+	s.running.mutex.Lock()
+	badDir := s.running.dir
+	var bad []*replica
+	if warm {
+		bad = s.running.replicas
+		s.running.replicas = previous //The kept replica is warm and takes all traffic at once
+		s.running.dir = dir
+	}
+	s.running.mutex.Unlock()
+	for _, r := range bad {
+		s.retire(r)
+	}
+	if !warm {
+		log.Warning("Kept replica of ", dir.File().Name(), " has stopped, rolling back with new replicas")
+		for _, r := range previous {
+			s.retire(r)
+		}
+	}
+	log.Warning("Rolling back from ", badDir.File().Name(), " to ", dir.File().Name(), ": ", reason)
+
+	s.rollOut(dir, nil, errorChan, func(err error) error { //Brings back the configured number of replicas
+		if err != nil {
+			if !warm { //The replicas of the bad version are still running
+				go slack.Sendf(" :rewind: :x: Vili failed to roll back on host: %s from version %s to %s. Reason: %s.", s.hostname, badDir.File().Name(), dir.File().Name(), reason)
+				s.archive(dir)
+				return err
+			}
+			log.AddError(err).Error("While starting replicas of rolled back version, only the kept replica is running")
+		}
+		s.quarantineVersion(badDir, "rolled back, "+reason, nil)
+		s.record(eventlog.ROLLEDBACK, dir, badDir, reason)
+		rollbacksTotal.Inc()
+		s.archive(badDir)
+		go slack.Sendf(" :rewind: Vili rolled back on host: %s from version %s to %s. Reason: %s.", s.hostname, badDir.File().Name(), dir.File().Name(), reason)
+		return nil
+	})
+}
+
+func (s *server) Rollback(reason string) error {
+	errorChan := make(chan error, 1)
+	defer close(errorChan)
+	s.serverCommands <- commandData{command: rollback, reason: reason, errorChan: errorChan}
+	return <-errorChan
+}
+
+func (s *server) HasPrevious() bool {
+	s.previous.mutex.Lock()
+	defer s.previous.mutex.Unlock()
+	return len(s.previous.replicas) > 0
+}
+
+// AddWatchBreaking counts a response from running that previous answered differently.
+func (s *server) AddWatchBreaking(route string) {
+	s.running.mutex.Lock()
+	defer s.running.mutex.Unlock()
+	if len(s.running.replicas) == 0 {
+		return
+	}
+	s.running.replicas[0].IncrementBreaking(route)
+}
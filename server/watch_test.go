@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cantara/vili/fslib"
+	"github.com/cantara/vili/server/servlet"
+	"github.com/cantara/vili/typelib"
+)
+
+func TestRollback(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		warm       bool
+		startFails bool
+		err        bool
+		running    string
+		archived   string
+	}{
+		{"warm", true, false, false, "app-1.0.0", "app-1.1.0"},
+		{"warm without new replicas", true, true, false, "app-1.0.0", "app-1.1.0"},
+		{"cold", false, false, false, "app-1.0.0", "app-1.1.0"},
+		{"cold without replicas", false, true, true, "app-1.1.0", "app-1.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, archived := newTestServer(t)
+			previousDir := versionDir(t, s, "app-1.0.0")
+			_, kept := addReplica(s, typelib.PREVIOUS, previousDir)
+			_, bad := addReplica(s, typelib.RUNNING, versionDir(t, s, "app-1.1.0"))
+			if !tc.warm {
+				kept.Kill()
+			}
+			s.newServlet = func(servletDir fslib.Dir, port string, _ typelib.ServerType) (servlet.Servlet, error) {
+				if tc.startFails && strings.Contains(servletDir.Path(), "app-1.0.0") {
+					return nil, errors.New("no java")
+				}
+				return newFakeServlet(servletDir, port, true), nil
+			}
+
+			err := s.Rollback("breaking")
+			if (err != nil) != tc.err {
+				t.Fatalf("Rollback = %v", err)
+			}
+			if s.GetRunningVersion() != tc.running {
+				t.Errorf("Running version is %s, expected %s", s.GetRunningVersion(), tc.running)
+			}
+			if v := versions(s, typelib.RUNNING); len(v) != 1 || v[0] != tc.running {
+				t.Errorf("Running replicas %v, expected one of %s", v, tc.running)
+			}
+			if bad.IsRunning() == (tc.running == "app-1.0.0") {
+				t.Errorf("Replica of the bad version running: %v", bad.IsRunning())
+			}
+			if s.Quarantined("app-1.1.0") != !tc.err {
+				t.Errorf("app-1.1.0 quarantined: %v", s.Quarantined("app-1.1.0"))
+			}
+			if s.HasPrevious() {
+				t.Error("Previous should be empty after a rollback")
+			}
+			expectArchived(t, archived, tc.archived)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package stats
+
+import "math"
+
+// Z returns the one sided standard normal quantile for the confidence, 0.95 gives 1.645.
+func Z(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*confidence-1)
+}
+
+func NormalCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// WilsonUpper is the one sided upper confidence bound of a proportion.
+func WilsonUpper(successes, n int64, confidence float64) float64 {
+	if n <= 0 {
+		return 1
+	}
+	z := Z(confidence)
+	p := float64(successes) / float64(n)
+	nf := float64(n)
+	denominator := 1 + z*z/nf
+	center := p + z*z/(2*nf)
+	margin := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf))
+	return math.Min(1, (center+margin)/denominator)
+}
+
+// PoissonUpper is the one sided upper confidence bound of a poisson count, using Byar's approximation.
+func PoissonUpper(count int64, confidence float64) float64 {
+	z := Z(confidence)
+	x := float64(count) + 1
+	return x * math.Pow(1-1/(9*x)+z/(3*math.Sqrt(x)), 3)
+}
+
+// RateUpper is the upper confidence bound of events per exposure, for example errors per request.
+func RateUpper(events, exposure int64, confidence float64) float64 {
+	if exposure <= 0 {
+		return math.Inf(1)
+	}
+	return PoissonUpper(events, confidence) / float64(exposure)
+}
+
+// WilsonLower is the one sided lower confidence bound of a proportion.
+func WilsonLower(successes, n int64, confidence float64) float64 {
+	if n <= 0 {
+		return 0
+	}
+	z := Z(confidence)
+	p := float64(successes) / float64(n)
+	nf := float64(n)
+	denominator := 1 + z*z/nf
+	center := p + z*z/(2*nf)
+	margin := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf))
+	return math.Max(0, (center-margin)/denominator)
+}
+
+// PoissonLower is the one sided lower confidence bound of a poisson count, using Byar's approximation.
+func PoissonLower(count int64, confidence float64) float64 {
+	if count <= 0 {
+		return 0
+	}
+	z := Z(confidence)
+	x := float64(count)
+	return math.Max(0, x*math.Pow(1-1/(9*x)-z/(3*math.Sqrt(x)), 3))
+}
+
+// RateLower is the lower confidence bound of events per exposure.
+func RateLower(events, exposure int64, confidence float64) float64 {
+	if exposure <= 0 {
+		return 0
+	}
+	return PoissonLower(events, confidence) / float64(exposure)
+}
+
+// TwoProportionZ is the pooled z statistic for p1 - p2 - margin, positive when the first proportion is larger.
+func TwoProportionZ(x1, n1, x2, n2 int64, margin float64) float64 {
+	if n1 <= 0 || n2 <= 0 {
+		return 0
+	}
+	p1 := float64(x1) / float64(n1)
+	p2 := float64(x2) / float64(n2)
+	pooled := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		if p1-p2 > margin {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return (p1 - p2 - margin) / se
+}
+
+// UpperTailP is the one sided p value of a z statistic.
+func UpperTailP(z float64) float64 {
+	return 1 - NormalCDF(z)
+}
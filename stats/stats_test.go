@@ -0,0 +1,78 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestZ(t *testing.T) {
+	if !near(Z(0.95), 1.6449, 0.0001) {
+		t.Errorf("Z(0.95) = %f", Z(0.95))
+	}
+	if !near(Z(0.975), 1.96, 0.0001) {
+		t.Errorf("Z(0.975) = %f", Z(0.975))
+	}
+	if !near(NormalCDF(Z(0.9)), 0.9, 0.0001) {
+		t.Errorf("NormalCDF(Z(0.9)) = %f", NormalCDF(Z(0.9)))
+	}
+}
+
+func TestPoissonUpper(t *testing.T) {
+	tests := []struct {
+		count    int64
+		expected float64
+	}{
+		{0, 2.996},
+		{1, 4.744},
+		{10, 17.0},
+	}
+	for _, test := range tests {
+		if u := PoissonUpper(test.count, 0.95); !near(u, test.expected, 0.05) {
+			t.Errorf("PoissonUpper(%d, 0.95) = %f, expected %f", test.count, u, test.expected)
+		}
+	}
+}
+
+func TestWilsonUpper(t *testing.T) {
+	if u := WilsonUpper(0, 100, 0.95); !near(u, 0.0263, 0.001) {
+		t.Errorf("WilsonUpper(0, 100) = %f", u)
+	}
+	if u := WilsonUpper(50, 100, 0.95); !near(u, 0.581, 0.001) {
+		t.Errorf("WilsonUpper(50, 100) = %f", u)
+	}
+	if WilsonUpper(0, 0, 0.95) != 1 {
+		t.Error("WilsonUpper without samples is not 1")
+	}
+}
+
+func TestLowerBounds(t *testing.T) {
+	if l := PoissonLower(10, 0.95); !near(l, 5.43, 0.05) {
+		t.Errorf("PoissonLower(10, 0.95) = %f", l)
+	}
+	if PoissonLower(0, 0.95) != 0 {
+		t.Error("PoissonLower(0) is not 0")
+	}
+	if l := WilsonLower(50, 100, 0.95); !near(l, 0.419, 0.001) {
+		t.Errorf("WilsonLower(50, 100) = %f", l)
+	}
+}
+
+func TestTwoProportionZ(t *testing.T) {
+	z := TwoProportionZ(60, 1000, 30, 1000, 0)
+	if !near(z, 3.25, 0.02) {
+		t.Errorf("TwoProportionZ(60/1000, 30/1000) = %f", z)
+	}
+	if !near(UpperTailP(z), 0.0006, 0.0002) {
+		t.Errorf("UpperTailP(%f) = %f", z, UpperTailP(z))
+	}
+	if TwoProportionZ(1, 10, 1, 10, 0) != 0 {
+		t.Error("Equal proportions do not give 0")
+	}
+	if TwoProportionZ(60, 1000, 30, 1000, 0.05) >= 0 {
+		t.Error("Difference inside margin is not negative")
+	}
+}
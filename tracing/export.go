@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/cantara/bragi"
+)
+
+const (
+	exportQueue    = 2048
+	exportBatch    = 512
+	exportInterval = time.Second * 5
+)
+
+// exporter sends spans in batches as OTLP/HTTP json, spans are dropped rather than slowing down requests.
+type exporter struct {
+	url      string
+	resource otlpResource
+	spans    chan *Span
+	client   http.Client
+	dropped  int64
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newExporter(endpoint, service string) *exporter {
+	hostname, _ := os.Hostname()
+	e := &exporter{
+		url: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		resource: otlpResource{Attributes: []otlpAttribute{
+			toAttribute("service.name", service),
+			toAttribute("host.name", hostname),
+			toAttribute("vili.identifier", os.Getenv("identifier")),
+		}},
+		spans:  make(chan *Span, exportQueue),
+		client: http.Client{Timeout: 10 * time.Second},
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *exporter) add(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	for {
+		select {
+		case s, ok := <-e.spans:
+			if !ok {
+				e.export(batch)
+				close(e.done)
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) < exportBatch {
+				continue
+			}
+		case <-ticker.C:
+		}
+		e.export(batch)
+		batch = nil
+	}
+}
+
+func (e *exporter) shutdown() {
+	e.stopOnce.Do(func() {
+		close(e.spans)
+	})
+	<-e.done
+}
+
+func (e *exporter) export(batch []*Span) {
+	if dropped := atomic.SwapInt64(&e.dropped, 0); dropped > 0 {
+		log.Warning("Dropped ", dropped, " spans, the export queue was full")
+	}
+	if len(batch) == 0 {
+		return
+	}
+	spans := make([]otlpSpan, len(batch))
+	for i, s := range batch {
+		spans[i] = s.otlp()
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   e.resource,
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/cantara/vili/tracing"}, Spans: spans}},
+	}}})
+	if err != nil {
+		log.AddError(err).Warning("While encoding spans")
+		return
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.AddError(err).Warning("While exporting ", len(batch), " spans")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Warning("Exporting ", len(batch), " spans to ", e.url, " got status ", resp.Status)
+	}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` //64 bit ints are strings in OTLP json
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func toAttribute(key string, value interface{}) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		a.Value.StringValue = &v
+	case int:
+		i := strconv.Itoa(v)
+		a.Value.IntValue = &i
+	case int64:
+		i := strconv.FormatInt(v, 10)
+		a.Value.IntValue = &i
+	case float64:
+		a.Value.DoubleValue = &v
+	case bool:
+		a.Value.BoolValue = &v
+	default:
+		str := fmt.Sprint(v)
+		a.Value.StringValue = &str
+	}
+	return a
+}
+
+const statusError = 2
+
+func (s *Span) otlp() otlpSpan {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	o := otlpSpan{
+		TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parent != [8]byte{} {
+		o.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, a := range s.attributes {
+		o.Attributes = append(o.Attributes, toAttribute(a.key, a.value))
+	}
+	for _, l := range s.links {
+		o.Links = append(o.Links, otlpLink{TraceID: hex.EncodeToString(l.TraceID[:]), SpanID: hex.EncodeToString(l.SpanID[:])})
+	}
+	if s.err != "" {
+		o.Status = otlpStatus{Code: statusError, Message: s.err}
+	}
+	return o
+}
@@ -0,0 +1,203 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathRand "math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cantara/vili/envlib"
+)
+
+// SpanContext is what is propagated in the W3C traceparent header.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// TraceIDString is blank for invalid contexts so it can be shown as is.
+func (sc SpanContext) TraceIDString() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// ParseTraceParent reads a traceparent header, versions after 00 are read as 00 like the spec asks.
+func ParseTraceParent(header string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+type Kind int
+
+const (
+	Internal Kind = iota + 1
+	Server
+	Client
+)
+
+// Tracer is nil when tracing is off, spans from a nil tracer do nothing.
+type Tracer struct {
+	exporter    *exporter
+	sampleRatio float64
+	random      *mathRand.Rand
+	mutex       sync.Mutex
+}
+
+// FromEnv exports to otlp_endpoint, like http://localhost:4318, and is off when it is blank.
+func FromEnv() *Tracer {
+	endpoint := os.Getenv("otlp_endpoint")
+	if endpoint == "" {
+		return nil
+	}
+	service := os.Getenv("otlp_service_name")
+	if service == "" {
+		service = "vili"
+	}
+	return New(endpoint, service, envlib.Float("trace_sample_ratio", 1))
+}
+
+func New(endpoint, service string, sampleRatio float64) *Tracer {
+	return &Tracer{
+		exporter:    newExporter(endpoint, service),
+		sampleRatio: sampleRatio,
+		random:      mathRand.New(mathRand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Start begins a span under parent, or a new trace when parent is not valid.
+func (t *Tracer) Start(name string, kind Kind, parent SpanContext, links ...SpanContext) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+	if parent.IsValid() {
+		s.context.TraceID = parent.TraceID
+		s.context.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.context.TraceID[:])
+		t.mutex.Lock()
+		s.context.Sampled = t.random.Float64() < t.sampleRatio
+		t.mutex.Unlock()
+	}
+	rand.Read(s.context.SpanID[:])
+	for _, l := range links {
+		if l.IsValid() {
+			s.links = append(s.links, l)
+		}
+	}
+	return s
+}
+
+// Shutdown exports what is left.
+func (t *Tracer) Shutdown() {
+	if t == nil {
+		return
+	}
+	t.exporter.shutdown()
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type Span struct {
+	tracer     *Tracer
+	context    SpanContext
+	parent     [8]byte
+	name       string
+	kind       Kind
+	start      time.Time
+	end        time.Time
+	attributes []attribute
+	links      []SpanContext
+	err        string
+	mutex      sync.Mutex
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute takes strings, ints, int64s, float64s and bools.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes = append(s.attributes, attribute{key: key, value: value})
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.err = err.Error()
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if !s.end.IsZero() {
+		s.mutex.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mutex.Unlock()
+	if s.context.Sampled {
+		s.tracer.exporter.add(s)
+	}
+}
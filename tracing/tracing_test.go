@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceParent(t *testing.T) {
+	for _, tc := range []struct {
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", false, false},
+		{"", false, false},
+	} {
+		sc, ok := ParseTraceParent(tc.header)
+		if ok != tc.ok || sc.Sampled != tc.sampled {
+			t.Errorf("ParseTraceParent(%q) = %v sampled %v, expected %v sampled %v", tc.header, ok, sc.Sampled, tc.ok, tc.sampled)
+		}
+		if ok && tc.header[:2] == "00" && sc.TraceParent() != tc.header {
+			t.Errorf("TraceParent() = %q, expected %q", sc.TraceParent(), tc.header)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	var received otlpRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Exported to %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer collector.Close()
+
+	tracer := New(collector.URL, "vili", 1)
+	parent, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	server := tracer.Start("proxy", Server, parent)
+	client := tracer.Start("running", Client, server.Context())
+	client.SetAttribute("http.response.status_code", 200)
+	client.End()
+	shadow := tracer.Start("shadow", Client, server.Context(), client.Context())
+	shadow.SetError(http.ErrHandlerTimeout)
+	shadow.End()
+	server.End()
+	unsampled := tracer.Start("unsampled", Server, SpanContext{TraceID: parent.TraceID, SpanID: parent.SpanID})
+	unsampled.End()
+	tracer.Shutdown()
+
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("Unexpected export %+v", received)
+	}
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("Exported %d spans, expected 3", len(spans))
+	}
+	if spans[0].TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || spans[0].ParentSpanID != spans[2].SpanID || spans[2].ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("Spans are not in the incoming trace: %+v", spans)
+	}
+	if *spans[0].Attributes[0].Value.IntValue != "200" {
+		t.Errorf("Status code attribute = %+v", spans[0].Attributes[0])
+	}
+	if len(spans[1].Links) != 1 || spans[1].Links[0].SpanID != spans[0].SpanID || spans[1].Status.Code != statusError {
+		t.Errorf("Shadow span = %+v", spans[1])
+	}
+
+	var off *Tracer
+	span := off.Start("off", Server, parent)
+	span.SetAttribute("key", "value")
+	span.End()
+	if span.Context().IsValid() {
+		t.Error("Spans without a tracer should do nothing")
+	}
+}
@@ -1,15 +1,18 @@
 package typelib
 
+import "time"
+
 type ServerType int
 
 const (
 	UNKNOWN ServerType = iota
 	RUNNING
 	TESTING
+	PREVIOUS
 )
 
 func (t ServerType) String() string {
-	return []string{"unknown", "running", "test"}[t]
+	return []string{"unknown", "running", "test", "previous"}[t]
 }
 
 func FromString(s string) ServerType {
@@ -18,6 +21,62 @@ func FromString(s string) ServerType {
 		return RUNNING
 	case TESTING.String():
 		return TESTING
+	case PREVIOUS.String():
+		return PREVIOUS
 	}
 	return UNKNOWN
 }
+
+type Counters struct {
+	Requests int64 `json:"requests"`
+	Breaking int64 `json:"breaking"`
+	Errors   int64 `json:"errors"`
+	Warnings int64 `json:"warnings"`
+	Weight   int64 `json:"weight"`
+}
+
+func (c Counters) Add(o Counters) Counters {
+	c.Requests += o.Requests
+	c.Breaking += o.Breaking
+	c.Errors += o.Errors
+	c.Warnings += o.Warnings
+	c.Weight += o.Weight
+	return c
+}
+
+type Observation struct {
+	Route   string
+	Status  int
+	Latency time.Duration
+}
+
+type RouteCounters struct {
+	Requests      int64         `json:"requests"`
+	Breaking      int64         `json:"breaking"`
+	StatusClasses [6]int64      `json:"status_classes"`
+	Latency       time.Duration `json:"latency_total"`
+}
+
+func StatusClass(status int) int {
+	if status < 100 || status > 599 {
+		return 0
+	}
+	return status / 100
+}
+
+func (c RouteCounters) Add(o RouteCounters) RouteCounters {
+	c.Requests += o.Requests
+	c.Breaking += o.Breaking
+	for i := range c.StatusClasses {
+		c.StatusClasses[i] += o.StatusClasses[i]
+	}
+	c.Latency += o.Latency
+	return c
+}
+
+func (c RouteCounters) MeanLatency() time.Duration {
+	if c.Requests == 0 {
+		return 0
+	}
+	return c.Latency / time.Duration(c.Requests)
+}
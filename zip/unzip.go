@@ -0,0 +1,111 @@
+package zip
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/cantara/bragi"
+	"github.com/cantara/vili/fslib"
+)
+
+type Archive struct {
+	Version  string    `json:"version"`
+	Size     int64     `json:"size"`
+	Archived time.Time `json:"archived"`
+}
+
+// List returns the archived versions, newest first.
+func (z Zipper) List() (archives []Archive, err error) {
+	entries, err := os.ReadDir(z.Dir.Path())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".zip") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			log.AddError(err).Debug("While reading archive ", entry.Name())
+			continue
+		}
+		archives = append(archives, Archive{
+			Version:  strings.TrimSuffix(entry.Name(), ".zip"),
+			Size:     info.Size(),
+			Archived: info.ModTime(),
+		})
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].Archived.After(archives[j].Archived)
+	})
+	return
+}
+
+// Unzip extracts an archived version into a version directory in dst, the archive is kept.
+func (z Zipper) Unzip(version string, dst fslib.Dir) (serverDir fslib.Dir, err error) {
+	if version == "" || strings.ContainsAny(version, `/\`) || version == ".." {
+		err = fmt.Errorf("Invalid version %q", version)
+		return
+	}
+	r, err := zip.OpenReader(filepath.Join(z.Dir.Path(), version+".zip"))
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	target := filepath.Join(dst.Path(), version)
+	if _, err = os.Stat(target); err == nil {
+		err = fmt.Errorf("Version directory %s allready exists", version)
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(target) //So a failed extract does not look like a version on the next try
+		}
+	}()
+	log.Println("Extracting archived server ", version)
+	for _, f := range r.File {
+		name := filepath.Clean(f.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			err = fmt.Errorf("Archive %s contains invalid path %s", version, f.Name)
+			return
+		}
+		path := filepath.Join(target, name)
+		if f.FileInfo().IsDir() {
+			err = os.MkdirAll(path, 0755)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		err = extract(f, path)
+		if err != nil {
+			return
+		}
+	}
+	return dst.Cd(version)
+}
+
+func extract(f *zip.File, path string) (err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return
+	}
+	in, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return
+}
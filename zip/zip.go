@@ -5,6 +5,7 @@ import (
 	"compress/flate"
 	"io"
 	"io/ioutil"
+	"path/filepath"
 
 	log "github.com/cantara/bragi"
 	"github.com/cantara/vili/fslib"
@@ -42,15 +43,15 @@ func (z Zipper) ZipDir(serverDir fslib.Dir) (err error) {
 }
 
 func addFiles(w *zip.Writer, serverDir fslib.Dir, baseInZip string) (err error) {
-	files, err := serverDir.ReadDir("*")
+	files, err := serverDir.ReadDir(".")
 	if err != nil {
 		return
 	}
 
 	for _, file := range files {
-		log.Println("ziping: " + serverDir.Path() + file.Name())
+		log.Println("ziping: " + filepath.Join(serverDir.Path(), file.Name()))
 		if !file.IsDir() {
-			dat, err := ioutil.ReadFile(serverDir.Path() + file.Name())
+			dat, err := ioutil.ReadFile(filepath.Join(serverDir.Path(), file.Name()))
 			if err != nil {
 				log.Println(err)
 				continue
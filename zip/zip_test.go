@@ -0,0 +1,109 @@
+package zip
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cantara/vili/fslib"
+)
+
+func TestZipAndUnzip(t *testing.T) {
+	base := t.TempDir()
+	for _, dir := range []string{"archive", "app-1.0.0/instance/logs"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"app-1.0.0/app-1.0.0.jar":       "jar",
+		"app-1.0.0/instance/logs/a.log": "log line",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(base, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	baseDir, err := fslib.NewDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveDir, err := baseDir.Cd("archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverDir, err := baseDir.Cd("app-1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := Zipper{Dir: archiveDir}
+	if err = z.ZipDir(serverDir); err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := z.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 1 || archives[0].Version != "app-1.0.0" {
+		t.Fatalf("Expected one archive of app-1.0.0, got %v", archives)
+	}
+	if _, err = z.Unzip("../app-1.0.0", &baseDir); err == nil {
+		t.Error("Unzip should not accept paths as versions")
+	}
+	if _, err = z.Unzip("app-1.0.0", &baseDir); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(base, name))
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v, expected %q", name, got, err, content)
+		}
+	}
+	if _, err = z.Unzip("app-1.0.0", &baseDir); err == nil {
+		t.Error("Unzip should not overwrite an existing version")
+	}
+}
+
+func TestUnzipCorruptArchive(t *testing.T) {
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "archive"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"app-1.0.0.jar", "instance/app.properties"} {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte("content of " + name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Replace(buf.Bytes(), []byte("content of instance"), []byte("corrupt of instance"), 1) //Fails the checksum of the second file
+	if err := os.WriteFile(filepath.Join(base, "archive", "app-1.0.0.zip"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	baseDir, err := fslib.NewDir(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveDir, err := baseDir.Cd("archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := Zipper{Dir: archiveDir}
+	if _, err = z.Unzip("app-1.0.0", &baseDir); err == nil {
+		t.Fatal("Unzip of a corrupt archive should fail")
+	}
+	if _, err = os.Stat(filepath.Join(base, "app-1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("The partly extracted version directory was left behind, %v", err)
+	}
+}